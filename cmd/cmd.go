@@ -1,11 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
 
 	"github.com/go-redis/redis"
 	"github.com/pkg/errors"
+	"github.com/yansal/q"
+	"github.com/yansal/q/qotel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 )
 
 func NewRedis() (*redis.Client, error) {
@@ -25,3 +33,48 @@ func NewRedis() (*redis.Client, error) {
 	redis := redis.NewClient(redisOpts)
 	return redis, errors.WithStack(redis.Ping().Err())
 }
+
+// NewTracer returns a tracer propagating the W3C trace context through
+// messages. Spans are exported with OTLP over HTTP when
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is set.
+// The returned function flushes the spans.
+func NewTracer() (q.Tracer, func() error, error) {
+	propagator := propagation.TraceContext{}
+	if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return qotel.New(qotel.WithPropagator(propagator)), func() error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(context.Background())
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter))
+	tracer := qotel.New(
+		qotel.WithTracerProvider(provider),
+		qotel.WithPropagator(propagator),
+	)
+	return tracer, func() error {
+		return errors.WithStack(provider.Shutdown(context.Background()))
+	}, nil
+}
+
+// NewLogger returns a logger writing to stderr. LOG_LEVEL sets the minimum
+// level (debug, info, warn or error) and LOG_FORMAT=json switches from text to
+// JSON output.
+func NewLogger() (*slog.Logger, error) {
+	var level slog.Level
+	if s := os.Getenv("LOG_LEVEL"); s != "" {
+		if err := level.UnmarshalText([]byte(s)); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	opts := &slog.HandlerOptions{Level: level}
+
+	var handler slog.Handler
+	if strings.EqualFold(os.Getenv("LOG_FORMAT"), "json") {
+		handler = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		handler = slog.NewTextHandler(os.Stderr, opts)
+	}
+	return slog.New(handler), nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yansal/q"
+	"github.com/yansal/q/cmd"
+)
+
+func failed(logger *slog.Logger) error {
+	flagset := flag.NewFlagSet("", flag.ExitOnError)
+	filter := failedFilterFlags(flagset)
+	cursor := flagset.Int64("cursor", 0, "cursor returned by a previous call")
+	limit := flagset.Int64("limit", 20, "maximum number of messages to print")
+	flagset.Parse(os.Args[2:])
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+
+	redis, err := cmd.NewRedis()
+	if err != nil {
+		return err
+	}
+	messages, next, err := q.New(redis, q.WithLogger(logger)).ListFailed(context.Background(), f, *cursor, *limit)
+	if err != nil {
+		return err
+	}
+	for _, m := range messages {
+		var failedAt string
+		if m.FailedAt != nil {
+			failedAt = m.FailedAt.Format(time.RFC3339)
+		}
+		errorLine := strings.SplitN(m.Error, "\n", 2)[0]
+		fmt.Printf("%d\t%s\t%s\t%q\t%s\n", m.FailedID, m.Queue, failedAt, m.Payload, errorLine)
+	}
+	if next != 0 {
+		fmt.Fprintf(os.Stderr, "next cursor: %d\n", next)
+	}
+	return nil
+}
+
+// failedFilterFlags defines the flags selecting failed messages on flagset.
+// The returned function builds the filter once flagset has been parsed.
+func failedFilterFlags(flagset *flag.FlagSet) func() (q.FailedFilter, error) {
+	queue := flagset.String("queue", "", "only messages from this queue")
+	errorFlag := flagset.String("error", "", "only messages whose error contains this string")
+	since := flagset.String("since", "", "only messages failed at or after this RFC 3339 time")
+	until := flagset.String("until", "", "only messages failed before this RFC 3339 time")
+	retried := flagset.String("retried", "", "only retried (true) or not retried (false) messages")
+
+	return func() (q.FailedFilter, error) {
+		filter := q.FailedFilter{Queue: *queue, Error: *errorFlag}
+		var err error
+		if *since != "" {
+			if filter.Since, err = time.Parse(time.RFC3339, *since); err != nil {
+				return filter, errors.WithStack(err)
+			}
+		}
+		if *until != "" {
+			if filter.Until, err = time.Parse(time.RFC3339, *until); err != nil {
+				return filter, errors.WithStack(err)
+			}
+		}
+		if *retried != "" {
+			b, err := strconv.ParseBool(*retried)
+			if err != nil {
+				return filter, errors.WithStack(err)
+			}
+			filter.Retried = &b
+		}
+		return filter, nil
+	}
+}
@@ -4,12 +4,15 @@ import (
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"sort"
+
+	qcmd "github.com/yansal/q/cmd"
 )
 
 type subcmd struct {
-	run   func() error
+	run   func(logger *slog.Logger) error
 	usage string
 }
 
@@ -17,11 +20,20 @@ var cmds map[string]subcmd
 
 func init() {
 	cmds = map[string]subcmd{
-		"help":    {run: help, usage: "print help message"},
-		"receive": {run: receive, usage: "run queue receiver"},
-		"send":    {run: send, usage: "send a message to a queue"},
-		"stats":   {run: stats, usage: "print stats"},
-		"web":     {run: web, usage: "run dashboard web server"},
+		"concurrency":  {run: concurrency, usage: "limit the number of messages of a queue handled at once"},
+		"delete":       {run: deleteFailed, usage: "delete failed messages"},
+		"delete-queue": {run: deleteQueue, usage: "delete a queue and its messages"},
+		"failed":       {run: failed, usage: "list failed messages"},
+		"help":         {run: help, usage: "print help message"},
+		"pause":        {run: pause, usage: "stop receiving messages from a queue"},
+		"purge":        {run: purge, usage: "delete all messages of a queue"},
+		"rate-limit":   {run: rateLimit, usage: "limit the rate of messages received from a queue"},
+		"receive":      {run: receive, usage: "run queue receiver"},
+		"resume":       {run: resume, usage: "resume receiving messages from a queue"},
+		"retry":        {run: retry, usage: "retry failed messages"},
+		"send":         {run: send, usage: "send a message to a queue"},
+		"stats":        {run: stats, usage: "print stats"},
+		"web":          {run: web, usage: "run dashboard web server"},
 	}
 }
 
@@ -34,11 +46,11 @@ func usage() {
 	fmt.Fprint(flag.CommandLine.Output(), "Usage:\n\n\tq <command> [arguments]\n\n")
 	fmt.Fprint(flag.CommandLine.Output(), "Commands:\n\n")
 	for _, name := range names {
-		fmt.Fprintf(flag.CommandLine.Output(), "\t%-8s\t%s\n", name, cmds[name].usage)
+		fmt.Fprintf(flag.CommandLine.Output(), "\t%-12s\t%s\n", name, cmds[name].usage)
 	}
 }
 
-func help() error {
+func help(*slog.Logger) error {
 	usage()
 	return nil
 }
@@ -52,7 +64,7 @@ func main() {
 
 	cmd, ok := cmds[flag.Arg(0)]
 	if !ok {
-		help()
+		usage()
 		code := 2
 		if len(flag.Arg(0)) == 0 {
 			code = 0
@@ -60,7 +72,17 @@ func main() {
 		os.Exit(code)
 	}
 
-	if err := cmd.run(); err != nil {
+	logger, err := qcmd.NewLogger()
+	if err != nil {
 		log.Fatalf("%+v", err)
 	}
+	// The log package writes to logger too.
+	slog.SetDefault(logger)
+
+	if err := cmd.run(logger); err != nil {
+		// The log package writes to the default slog logger now, print the
+		// error with its stack trace as is.
+		fmt.Fprintf(os.Stderr, "q: %+v\n", err)
+		os.Exit(1)
+	}
 }
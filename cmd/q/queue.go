@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/yansal/q"
+	"github.com/yansal/q/cmd"
+)
+
+func purge(logger *slog.Logger) error {
+	return queueCommand(logger, q.Q.Purge)
+}
+
+func deleteQueue(logger *slog.Logger) error {
+	return queueCommand(logger, q.Q.DeleteQueue)
+}
+
+func pause(logger *slog.Logger) error {
+	return queueCommand(logger, q.Q.Pause)
+}
+
+func resume(logger *slog.Logger) error {
+	return queueCommand(logger, q.Q.Resume)
+}
+
+func rateLimit(logger *slog.Logger) error {
+	flagset := flag.NewFlagSet("", flag.ExitOnError)
+	queue := flagset.String("queue", "", "name of the queue (required)")
+	limit := flagset.Int64("limit", 0, "number of messages received per interval, 0 to remove the rate limit")
+	interval := flagset.Duration("interval", time.Second, "interval of the rate limit")
+	flagset.Parse(os.Args[2:])
+
+	if *queue == "" || *limit < 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	redis, err := cmd.NewRedis()
+	if err != nil {
+		return err
+	}
+	return q.New(redis, q.WithLogger(logger)).SetRateLimit(context.Background(), *queue, q.RateLimit{Limit: *limit, Interval: *interval})
+}
+
+func concurrency(logger *slog.Logger) error {
+	flagset := flag.NewFlagSet("", flag.ExitOnError)
+	queue := flagset.String("queue", "", "name of the queue (required)")
+	limit := flagset.Int64("limit", 0, "number of messages handled at once, 0 to remove the concurrency limit")
+	flagset.Parse(os.Args[2:])
+
+	if *queue == "" || *limit < 0 {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	redis, err := cmd.NewRedis()
+	if err != nil {
+		return err
+	}
+	return q.New(redis, q.WithLogger(logger)).SetConcurrency(context.Background(), *queue, *limit)
+}
+
+func queueCommand(logger *slog.Logger, fn func(q.Q, context.Context, string) error) error {
+	flagset := flag.NewFlagSet("", flag.ExitOnError)
+	queue := flagset.String("queue", "", "name of the queue (required)")
+	flagset.Parse(os.Args[2:])
+
+	if *queue == "" {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	redis, err := cmd.NewRedis()
+	if err != nil {
+		return err
+	}
+	return fn(q.New(redis, q.WithLogger(logger)), context.Background(), *queue)
+}
@@ -4,7 +4,8 @@ import (
 	"context"
 	"flag"
 	"fmt"
-	"log"
+	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -14,12 +15,13 @@ import (
 	"github.com/pkg/errors"
 	"github.com/yansal/q"
 	"github.com/yansal/q/cmd"
+	"github.com/yansal/q/metrics"
 	"golang.org/x/sync/errgroup"
 )
 
-func receive() error {
+func receive(logger *slog.Logger) error {
 	handlers := map[string]q.Handler{
-		"debug": debugHandler,
+		"debug": debugHandler(logger),
 		"error": errorHandler,
 		"sleep": sleepHandler,
 	}
@@ -28,10 +30,14 @@ func receive() error {
 	flagset := flag.NewFlagSet("", flag.ExitOnError)
 	queue := flagset.String("queue", "", "name of the queue to receive from (required)")
 	handler := flagset.String("handler", "debug", fmt.Sprintf("handler to run when a message is received -- can be one of %s", strings.Join(handlerNames, ", ")))
+	metricsAddr := flagset.String("metrics", "", "address to serve the metrics of this worker on, e.g. :9100")
+	batch := flagset.Int("batch", 0, "receive messages in batches of at most this size")
+	wait := flagset.Duration("wait", time.Second, "maximum time to wait for a batch to fill up")
+	failExpired := flagset.Bool("fail-expired", false, "push expired messages to the failed list instead of dropping them")
 	flagset.Parse(os.Args[2:])
 
 	h, ok := handlers[*handler]
-	if *queue == "" || !ok {
+	if *queue == "" || !ok || *batch < 0 {
 		flagset.Usage()
 		os.Exit(2)
 	}
@@ -52,9 +58,39 @@ func receive() error {
 			return sentinelError{s}
 		}
 	})
+	tracer, flush, err := cmd.NewTracer()
+	if err != nil {
+		return err
+	}
+	defer flush()
+
+	collector := metrics.NewCollector()
+	options := []q.Option{q.WithLogger(logger), q.WithObserver(collector), q.WithTracer(tracer)}
+	if *failExpired {
+		options = append(options, q.WithFailExpired())
+	}
+	qq := q.New(redis, options...)
 	g.Go(func() error {
-		return q.New(redis).Receive(ctx, *queue, h)
+		if *batch > 0 {
+			return qq.ReceiveBatch(ctx, *queue, *batch, *wait, batchHandler(h))
+		}
+		return qq.Receive(ctx, *queue, h)
 	})
+	if *metricsAddr != "" {
+		g.Go(func() error {
+			// The queue metrics are served by q web, serving them from every
+			// worker would duplicate them.
+			s := http.Server{Addr: *metricsAddr, Handler: collector}
+			cerr := make(chan error)
+			go func() { cerr <- errors.WithStack(s.ListenAndServe()) }()
+			select {
+			case err := <-cerr:
+				return err
+			case <-ctx.Done():
+				return errors.WithStack(s.Shutdown(context.Background()))
+			}
+		})
+	}
 
 	err = g.Wait()
 	if _, ok := err.(sentinelError); ok {
@@ -67,9 +103,29 @@ type sentinelError struct{ os.Signal }
 
 func (e sentinelError) Error() string { return fmt.Sprint(e.Signal) }
 
-func debugHandler(ctx context.Context, payload string) error {
-	log.Print(payload)
-	return nil
+// batchHandler returns a batch handler running h with each message of the
+// batch.
+func batchHandler(h q.Handler) q.BatchHandler {
+	return func(ctx context.Context, messages []q.Message) error {
+		errs := make(q.BatchError)
+		for i := range messages {
+			if err := h(ctx, messages[i].Payload); err != nil {
+				errs[i] = err
+			}
+		}
+		if len(errs) > 0 {
+			return errs
+		}
+		return nil
+	}
+}
+
+// debugHandler returns a handler logging the payloads with logger.
+func debugHandler(logger *slog.Logger) q.Handler {
+	return func(ctx context.Context, payload string) error {
+		logger.InfoContext(ctx, "debug", "payload", payload)
+		return nil
+	}
 }
 
 func errorHandler(ctx context.Context, payload string) error {
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/yansal/q"
+	"github.com/yansal/q/cmd"
+)
+
+func retry(logger *slog.Logger) error {
+	flagset := flag.NewFlagSet("", flag.ExitOnError)
+	id := flagset.Int64("id", 0, "id of the failed message to retry")
+	filter := failedFilterFlags(flagset)
+	all := flagset.Bool("all", false, "retry all failed messages when no filter is set; messages retried already are skipped unless -retried is set")
+	flagset.Parse(os.Args[2:])
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	if *id <= 0 && f == (q.FailedFilter{}) && !*all {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	redis, err := cmd.NewRedis()
+	if err != nil {
+		return err
+	}
+	if *id > 0 {
+		return q.New(redis, q.WithLogger(logger)).Retry(context.Background(), *id)
+	}
+	n, err := q.New(redis, q.WithLogger(logger)).RetryAll(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("retried %d messages\n", n)
+	return nil
+}
+
+func deleteFailed(logger *slog.Logger) error {
+	flagset := flag.NewFlagSet("", flag.ExitOnError)
+	filter := failedFilterFlags(flagset)
+	all := flagset.Bool("all", false, "delete all failed messages when no filter is set")
+	flagset.Parse(os.Args[2:])
+
+	f, err := filter()
+	if err != nil {
+		return err
+	}
+	if f == (q.FailedFilter{}) && !*all {
+		flagset.Usage()
+		os.Exit(2)
+	}
+
+	redis, err := cmd.NewRedis()
+	if err != nil {
+		return err
+	}
+	n, err := q.New(redis, q.WithLogger(logger)).DeleteFailed(context.Background(), f)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("deleted %d messages\n", n)
+	return nil
+}
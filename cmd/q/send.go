@@ -1,21 +1,35 @@
 package main
 
 import (
+	"bufio"
 	"context"
 	"flag"
+	"fmt"
+	"io"
+	"log/slog"
 	"os"
+	"time"
 
+	"github.com/pkg/errors"
 	"github.com/yansal/q"
 	"github.com/yansal/q/cmd"
 )
 
-func send() error {
+// maxPayload is the maximum size of a payload read by send -file.
+const maxPayload = 16 << 20
+
+func send(logger *slog.Logger) error {
 	flagset := flag.NewFlagSet("", flag.ExitOnError)
 	queue := flagset.String("queue", "", "name of the queue to send to (required)")
-	payload := flagset.String("payload", "", "payload to send (required)")
+	payload := flagset.String("payload", "", "payload to send")
+	file := flagset.String("file", "", "file of newline-delimited payloads to send, - for stdin; empty lines are skipped")
+	batch := flagset.Int("batch", 1000, "number of payloads from -file sent per transaction")
+	unique := flagset.String("unique", "", "drop the payload if a message with this unique key is pending or running")
+	ttl := flagset.Duration("ttl", time.Hour, "expiry of the -unique lock, 0 for none")
+	expires := flagset.Duration("expires", 0, "discard the payloads not handled within this duration, 0 for never")
 	flagset.Parse(os.Args[2:])
 
-	if *queue == "" || *payload == "" {
+	if *queue == "" || (*payload == "") == (*file == "") || *batch <= 0 || (*unique != "" && *file != "") || *expires < 0 {
 		flagset.Usage()
 		os.Exit(2)
 	}
@@ -24,5 +38,64 @@ func send() error {
 	if err != nil {
 		return err
 	}
-	return q.New(redis).Send(context.Background(), *queue, *payload)
+	tracer, flush, err := cmd.NewTracer()
+	if err != nil {
+		return err
+	}
+	qq := q.New(redis, q.WithLogger(logger), q.WithTracer(tracer))
+	ctx := context.Background()
+
+	var options []q.SendOption
+	if *expires > 0 {
+		options = append(options, q.ExpiresAt(time.Now().Add(*expires)))
+	}
+	if *file == "" {
+		if *unique != "" {
+			options = append(options, q.Unique(*unique, *ttl))
+		}
+		if _, err := qq.Send(ctx, *queue, *payload, options...); err == q.ErrDuplicate {
+			fmt.Fprintln(os.Stderr, "duplicate message dropped")
+		} else if err != nil {
+			return err
+		}
+		return flush()
+	}
+
+	var r io.Reader = os.Stdin
+	if *file != "-" {
+		f, err := os.Open(*file)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer f.Close()
+		r = f
+	}
+	if err := sendLines(ctx, qq, *queue, r, *batch, options...); err != nil {
+		return err
+	}
+	return flush()
+}
+
+// sendLines sends the non-empty lines of r to queue, batch lines at a time,
+// with options.
+func sendLines(ctx context.Context, qq q.Q, queue string, r io.Reader, batch int, options ...q.SendOption) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, maxPayload)
+	payloads := make([]string, 0, batch)
+	for scanner.Scan() {
+		if scanner.Text() == "" {
+			continue
+		}
+		payloads = append(payloads, scanner.Text())
+		if len(payloads) == batch {
+			if err := qq.SendBatch(ctx, queue, payloads, options...); err != nil {
+				return err
+			}
+			payloads = payloads[:0]
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	return qq.SendBatch(ctx, queue, payloads, options...)
 }
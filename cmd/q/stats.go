@@ -3,17 +3,18 @@ package main
 import (
 	"context"
 	"fmt"
+	"log/slog"
 
 	"github.com/yansal/q"
 	"github.com/yansal/q/cmd"
 )
 
-func stats() error {
+func stats(logger *slog.Logger) error {
 	redis, err := cmd.NewRedis()
 	if err != nil {
 		return err
 	}
-	stats, err := q.New(redis).Stats(context.Background())
+	stats, err := q.New(redis, q.WithLogger(logger)).Stats(context.Background())
 	if err != nil {
 		return err
 	}
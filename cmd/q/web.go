@@ -1,41 +1,138 @@
 package main
 
 import (
+	"flag"
+	"log/slog"
 	"net"
 	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/yansal/q"
 	"github.com/yansal/q/cmd"
+	"github.com/yansal/q/metrics"
 	qmux "github.com/yansal/q/mux"
 )
 
-func web() error {
+func web(logger *slog.Logger) error {
+	flagset := flag.NewFlagSet("", flag.ExitOnError)
+	addr := flagset.String("addr", "", "address to listen on (default :$PORT with Q_WEB_USERS or Q_WEB_TOKENS, localhost:$PORT without; $PORT defaults to 8080)")
+	flagset.Parse(os.Args[2:])
+
 	redis, err := cmd.NewRedis()
 	if err != nil {
 		return err
 	}
-	q := q.New(redis)
+	tracer, flush, err := cmd.NewTracer()
+	if err != nil {
+		return err
+	}
+	defer flush()
+	// Every dashboard tab streams stats, share them.
+	q := q.New(redis, q.WithLogger(logger), q.WithTracer(tracer), q.WithStatsCache(time.Second))
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	options := []qmux.Option{qmux.WithLogger(logger)}
+	authenticate := webAuth()
+	if authenticate != nil {
+		options = append(options, qmux.WithAuth(authenticate))
 	}
 
-	qmux, err := qmux.New(q)
+	// Without authentication, every request is an admin: the dashboard only
+	// listens on all the interfaces when asked to.
+	if *addr == "" {
+		port := os.Getenv("PORT")
+		if port == "" {
+			port = "8080"
+		}
+		*addr = ":" + port
+		if authenticate == nil {
+			*addr = "localhost:" + port
+		}
+	} else if authenticate == nil && !loopback(*addr) {
+		logger.Warn("serving the dashboard without authentication", "addr", *addr)
+	}
+	// The metrics are behind the authentication of the dashboard.
+	metrics := qmux.Authorize(metrics.Handler(q, logger), options...)
+	qmux, err := qmux.New(q, options...)
 	if err != nil {
 		return err
 	}
 
 	mux := http.NewServeMux()
 	mux.Handle("/favicon.ico", http.NotFoundHandler())
+	mux.Handle("/metrics", metrics)
 	mux.Handle("/", qmux)
 	s := http.Server{Handler: mux}
 
-	l, err := net.Listen("tcp", ":"+port)
+	l, err := net.Listen("tcp", *addr)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 	return errors.WithStack(s.Serve(l))
 }
+
+// webAuth returns the authenticator configured with the Q_WEB_USERS and
+// Q_WEB_TOKENS environment variables, or nil when both are empty.
+//
+// Q_WEB_USERS is a comma-separated list of name:password[:admin] users and
+// Q_WEB_TOKENS a comma-separated list of token[:admin] bearer tokens. Users
+// and tokens without the admin suffix are read-only.
+func webAuth() qmux.Authenticator {
+	var authenticators []qmux.Authenticator
+
+	var users []qmux.User
+	for _, s := range splitList(os.Getenv("Q_WEB_USERS")) {
+		s, role := parseRole(s)
+		name, password, _ := strings.Cut(s, ":")
+		users = append(users, qmux.User{Name: name, Password: password, Role: role})
+	}
+	if len(users) > 0 {
+		authenticators = append(authenticators, qmux.BasicAuth(users...))
+	}
+
+	tokens := make(map[string]qmux.Principal)
+	for _, s := range splitList(os.Getenv("Q_WEB_TOKENS")) {
+		token, role := parseRole(s)
+		tokens[token] = qmux.Principal{Name: "token", Role: role}
+	}
+	if len(tokens) > 0 {
+		authenticators = append(authenticators, qmux.BearerTokens(tokens))
+	}
+
+	if len(authenticators) == 0 {
+		return nil
+	}
+	return qmux.AnyOf(authenticators...)
+}
+
+// loopback reports whether addr only listens on the loopback interface.
+func loopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func splitList(s string) []string {
+	var list []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+func parseRole(s string) (string, qmux.Role) {
+	if s, ok := strings.CutSuffix(s, ":admin"); ok {
+		return s, qmux.RoleAdmin
+	}
+	return s, qmux.RoleReadOnly
+}
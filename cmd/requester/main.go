@@ -147,7 +147,7 @@ func (h *handler) servePOST(w http.ResponseWriter, r *http.Request) error {
 	if err != nil {
 		return err
 	}
-	if err := h.q.Send(r.Context(), motherqueue, string(payload)); err != nil {
+	if _, err := h.q.Send(r.Context(), motherqueue, string(payload)); err != nil {
 		return err
 	}
 
@@ -30,5 +30,6 @@ func (m *mother) handle(ctx context.Context, payload string) error {
 		}
 	}()
 
-	return m.q.Send(ctx, p.URL, "")
+	_, err := m.q.Send(ctx, p.URL, "")
+	return err
 }
@@ -24,5 +24,6 @@ func (m *requester) handle(ctx context.Context, payload string) error {
 		log.Printf("duration:%s status:%d", time.Since(start), resp.StatusCode)
 	}
 
-	return m.q.Send(ctx, m.url, "")
+	_, err = m.q.Send(ctx, m.url, "")
+	return err
 }
@@ -0,0 +1,260 @@
+// Package metrics exposes q metrics in the Prometheus text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yansal/q"
+)
+
+// Handler returns a handler serving the metrics computed from the stats of q,
+// followed by the metrics of collectors. Errors getting the stats are logged
+// with logger.
+//
+// The stats of q are shared by all the processes using the same Redis, so
+// they should be served by a single process, like q web. Workers serve the
+// metrics of their own Collector.
+func Handler(q q.Q, logger q.Logger, collectors ...*Collector) http.Handler {
+	return &handler{q: q, logger: logger, collectors: collectors}
+}
+
+type handler struct {
+	q          q.Q
+	logger     q.Logger
+	collectors []*Collector
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.q.Stats(r.Context())
+	if err != nil {
+		h.logger.Error("getting stats failed", "error", fmt.Sprintf("%+v", err))
+		status := http.StatusInternalServerError
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	bw := bufio.NewWriter(w)
+	writeStats(bw, stats)
+	for _, c := range h.collectors {
+		c.WriteTo(bw)
+	}
+	bw.Flush()
+}
+
+func writeStats(w io.Writer, stats q.Stats) {
+	queues := make([]string, 0, len(stats.Queues))
+	for queue := range stats.Queues {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+
+	header(w, "q_queue_length", "gauge", "Number of messages waiting in the queue.")
+	for _, queue := range queues {
+		sample(w, "q_queue_length", labels("queue", queue), float64(stats.Queues[queue]))
+	}
+	header(w, "q_queue_paused", "gauge", "Whether the queue is paused.")
+	for _, queue := range queues {
+		var paused float64
+		if stats.Paused[queue] {
+			paused = 1
+		}
+		sample(w, "q_queue_paused", labels("queue", queue), paused)
+	}
+	header(w, "q_queue_concurrency_limit", "gauge", "Number of messages of the queue handled at once at most.")
+	for _, queue := range queues {
+		if limit, ok := stats.Concurrency[queue]; ok {
+			sample(w, "q_queue_concurrency_limit", labels("queue", queue), float64(limit))
+		}
+	}
+	header(w, "q_queue_leases", "gauge", "Number of workers holding a lease on the queue.")
+	for _, queue := range queues {
+		if _, ok := stats.Concurrency[queue]; ok {
+			sample(w, "q_queue_leases", labels("queue", queue), float64(stats.QueueStats[queue].Leases))
+		}
+	}
+	header(w, "q_queue_rate_limit", "gauge", "Number of messages per second the queue is limited to.")
+	for _, queue := range queues {
+		if limit, ok := stats.RateLimits[queue]; ok {
+			sample(w, "q_queue_rate_limit", labels("queue", queue), float64(limit.Limit)/limit.Interval.Seconds())
+		}
+	}
+
+	header(w, "q_processed_total", "counter", "Number of messages processed.")
+	for _, queue := range queues {
+		sample(w, "q_processed_total", labels("queue", queue), float64(stats.QueueStats[queue].Processed))
+	}
+	header(w, "q_failed_total", "counter", "Number of messages failed.")
+	for _, queue := range queues {
+		sample(w, "q_failed_total", labels("queue", queue), float64(stats.QueueStats[queue].Failed))
+	}
+	header(w, "q_retried_total", "counter", "Number of failed messages retried.")
+	for _, queue := range queues {
+		sample(w, "q_retried_total", labels("queue", queue), float64(stats.QueueStats[queue].Retried))
+	}
+	header(w, "q_expired_total", "counter", "Number of messages expired before being handled.")
+	for _, queue := range queues {
+		sample(w, "q_expired_total", labels("queue", queue), float64(stats.QueueStats[queue].Expired))
+	}
+
+	header(w, "q_queue_oldest_message_age_seconds", "gauge", "Age of the oldest message waiting in the queue.")
+	for _, queue := range queues {
+		sample(w, "q_queue_oldest_message_age_seconds", labels("queue", queue), stats.QueueStats[queue].OldestAge.Seconds())
+	}
+	header(w, "q_queue_wait_time_seconds", "summary", "Time the messages of the last hour waited in the queue.")
+	for _, queue := range queues {
+		percentiles(w, "q_queue_wait_time_seconds", queue, stats.QueueStats[queue].WaitTime)
+	}
+	header(w, "q_queue_run_time_seconds", "summary", "Time the handlers of the messages of the last hour ran.")
+	for _, queue := range queues {
+		percentiles(w, "q_queue_run_time_seconds", queue, stats.QueueStats[queue].RunTime)
+	}
+
+	header(w, "q_workers", "gauge", "Number of workers.")
+	sample(w, "q_workers", "", float64(len(stats.Workers)))
+}
+
+// percentiles writes the quantiles of the summary name. The summary has no
+// _sum and _count samples: the histograms of q don't keep them.
+func percentiles(w io.Writer, name, queue string, p q.Percentiles) {
+	sample(w, name, labels("queue", queue, "quantile", "0.5"), p.P50.Seconds())
+	sample(w, name, labels("queue", queue, "quantile", "0.9"), p.P90.Seconds())
+	sample(w, name, labels("queue", queue, "quantile", "0.99"), p.P99.Seconds())
+	sample(w, name, labels("queue", queue, "quantile", "1"), p.Max.Seconds())
+}
+
+func header(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func sample(w io.Writer, name, labels string, value float64) {
+	fmt.Fprintf(w, "%s%s %g\n", name, labels, value)
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// labels formats the pairs of label names and values.
+func labels(pairs ...string) string {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i < len(pairs); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		fmt.Fprintf(&b, `%s="%s"`, pairs[i], labelReplacer.Replace(pairs[i+1]))
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+// DefaultBuckets are the upper bounds, in seconds, of the handler duration
+// histogram buckets.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector is a q.Observer collecting the durations and results of the
+// handlers run in the current process.
+type Collector struct {
+	buckets []float64
+
+	mu       sync.Mutex
+	handlers map[string]*histogram
+	failures map[string]int64
+}
+
+type histogram struct {
+	counts []int64 // cumulative counts, one per bucket
+	count  int64
+	sum    float64
+}
+
+// NewCollector returns a collector with DefaultBuckets.
+func NewCollector() *Collector {
+	return &Collector{
+		buckets:  DefaultBuckets,
+		handlers: make(map[string]*histogram),
+		failures: make(map[string]int64),
+	}
+}
+
+// Handled implements q.Observer.
+func (c *Collector) Handled(queue string, message q.Message, duration time.Duration, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	h, ok := c.handlers[queue]
+	if !ok {
+		h = &histogram{counts: make([]int64, len(c.buckets))}
+		c.handlers[queue] = h
+	}
+	seconds := duration.Seconds()
+	for i, bound := range c.buckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+
+	if err != nil {
+		c.failures[queue]++
+	}
+}
+
+// WriteTo writes the metrics of c to w.
+func (c *Collector) WriteTo(w io.Writer) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	queues := make([]string, 0, len(c.handlers))
+	for queue := range c.handlers {
+		queues = append(queues, queue)
+	}
+	sort.Strings(queues)
+
+	cw := &countWriter{w: w}
+	header(cw, "q_handler_duration_seconds", "histogram", "Duration of the handlers run by this process.")
+	for _, queue := range queues {
+		h := c.handlers[queue]
+		for i, bound := range c.buckets {
+			sample(cw, "q_handler_duration_seconds_bucket", labels("queue", queue, "le", fmt.Sprint(bound)), float64(h.counts[i]))
+		}
+		sample(cw, "q_handler_duration_seconds_bucket", labels("queue", queue, "le", "+Inf"), float64(h.count))
+		sample(cw, "q_handler_duration_seconds_sum", labels("queue", queue), h.sum)
+		sample(cw, "q_handler_duration_seconds_count", labels("queue", queue), float64(h.count))
+	}
+	header(cw, "q_handler_failures_total", "counter", "Number of handlers run by this process that returned an error.")
+	for _, queue := range queues {
+		sample(cw, "q_handler_failures_total", labels("queue", queue), float64(c.failures[queue]))
+	}
+	return cw.n, errors.WithStack(cw.err)
+}
+
+// ServeHTTP serves the metrics of c alone.
+func (c *Collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	c.WriteTo(w)
+}
+
+type countWriter struct {
+	w   io.Writer
+	n   int64
+	err error
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	if w.err != nil {
+		return 0, w.err
+	}
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	w.err = err
+	return n, err
+}
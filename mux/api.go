@@ -0,0 +1,284 @@
+package mux
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yansal/q"
+)
+
+// apiHandler serves the JSON API, under /api/v1/. Unversioned paths under
+// /api/ are served by the latest version. Durations are encoded as integer
+// nanoseconds, like the time.Duration fields of package q.
+type apiHandler struct{ *handler }
+
+// crossOrigin rejects the unsafe requests to the API made by browsers from
+// other origins.
+var crossOrigin = http.NewCrossOriginProtection()
+
+func (h apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := crossOrigin.Check(r); err != nil {
+		h.writeError(w, r, httpError{err: err, code: http.StatusForbidden})
+		return
+	}
+	if err := h.serveHTTP(w, r); err != nil {
+		h.writeError(w, r, err)
+	}
+}
+
+func (h apiHandler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	herr := h.httpError(r, err)
+	writeJSON(w, herr.code, struct {
+		Error string `json:"error"`
+	}{Error: herr.Error()})
+}
+
+func (h apiHandler) serveHTTP(w http.ResponseWriter, r *http.Request) error {
+	path, ok := strings.CutPrefix(r.URL.EscapedPath(), "/api/v1/")
+	if !ok {
+		path = strings.TrimPrefix(r.URL.EscapedPath(), "/api/")
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	for i := range parts {
+		part, err := url.PathUnescape(parts[i])
+		if err != nil {
+			return httpError{err: err, code: http.StatusBadRequest}
+		}
+		parts[i] = part
+	}
+
+	switch {
+	case len(parts) == 1 && parts[0] == "stats":
+		if r.Method != http.MethodGet {
+			return httpError{code: http.StatusMethodNotAllowed}
+		}
+		return h.getStats(w, r)
+	case len(parts) == 1 && parts[0] == "queues":
+		if r.Method != http.MethodGet {
+			return httpError{code: http.StatusMethodNotAllowed}
+		}
+		return h.getQueues(w, r)
+	case len(parts) == 3 && parts[0] == "queues" && parts[2] == "messages":
+		if r.Method != http.MethodPost {
+			return httpError{code: http.StatusMethodNotAllowed}
+		}
+		return h.postMessage(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "queues" && parts[2] == "rate-limit":
+		if r.Method != http.MethodPut {
+			return httpError{code: http.StatusMethodNotAllowed}
+		}
+		return h.putRateLimit(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "queues" && parts[2] == "concurrency":
+		if r.Method != http.MethodPut {
+			return httpError{code: http.StatusMethodNotAllowed}
+		}
+		return h.putConcurrency(w, r, parts[1])
+	case len(parts) == 3 && parts[0] == "queues" && parts[2] == "history":
+		if r.Method != http.MethodGet {
+			return httpError{code: http.StatusMethodNotAllowed}
+		}
+		return h.getHistory(w, r, parts[1])
+	case len(parts) == 1 && parts[0] == "failed":
+		if r.Method != http.MethodGet {
+			return httpError{code: http.StatusMethodNotAllowed}
+		}
+		return h.getFailed(w, r)
+	case len(parts) == 3 && parts[0] == "failed" && parts[2] == "retry":
+		if r.Method != http.MethodPost {
+			return httpError{code: http.StatusMethodNotAllowed}
+		}
+		return h.postRetry(w, r, parts[1])
+	default:
+		return httpError{code: http.StatusNotFound}
+	}
+}
+
+func (h apiHandler) getStats(w http.ResponseWriter, r *http.Request) error {
+	stats, err := h.q.Stats(r.Context())
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, stats)
+	return nil
+}
+
+type apiQueue struct {
+	Name   string `json:"name"`
+	Length int64  `json:"length"`
+	Paused bool   `json:"paused"`
+	// RateLimit is the rate limit of the queue, if any.
+	RateLimit *q.RateLimit `json:"rate_limit,omitempty"`
+	// Concurrency is the concurrency limit of the queue, if any.
+	Concurrency int64 `json:"concurrency,omitempty"`
+	q.QueueStats
+}
+
+func (h apiHandler) getQueues(w http.ResponseWriter, r *http.Request) error {
+	stats, err := h.q.Stats(r.Context())
+	if err != nil {
+		return err
+	}
+	queues := make([]apiQueue, 0, len(stats.Queues))
+	for name, length := range stats.Queues {
+		queue := apiQueue{
+			Name:       name,
+			Length:     length,
+			Paused:     stats.Paused[name],
+			QueueStats: stats.QueueStats[name],
+		}
+		if limit, ok := stats.RateLimits[name]; ok {
+			queue.RateLimit = &limit
+		}
+		queue.Concurrency = stats.Concurrency[name]
+		queues = append(queues, queue)
+	}
+	sort.Slice(queues, func(i, j int) bool { return queues[i].Name < queues[j].Name })
+	writeJSON(w, http.StatusOK, queues)
+	return nil
+}
+
+func (h apiHandler) postMessage(w http.ResponseWriter, r *http.Request, queue string) error {
+	var body struct {
+		Payload   *string `json:"payload"`
+		UniqueKey string  `json:"unique_key"`
+		// UniqueTTL is a duration, like "1h".
+		UniqueTTL string `json:"unique_ttl"`
+		// ExpiresIn is a duration, like "10m".
+		ExpiresIn string `json:"expires_in"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return httpError{err: err, code: http.StatusBadRequest}
+	}
+	if body.Payload == nil {
+		return httpError{err: errors.New("payload is required"), code: http.StatusBadRequest}
+	}
+	var options []q.SendOption
+	if body.UniqueKey != "" {
+		var ttl time.Duration
+		if body.UniqueTTL != "" {
+			var err error
+			if ttl, err = time.ParseDuration(body.UniqueTTL); err != nil {
+				return httpError{err: err, code: http.StatusBadRequest}
+			}
+		}
+		options = append(options, q.Unique(body.UniqueKey, ttl))
+	}
+	if body.ExpiresIn != "" {
+		d, err := time.ParseDuration(body.ExpiresIn)
+		if err != nil {
+			return httpError{err: err, code: http.StatusBadRequest}
+		}
+		options = append(options, q.ExpiresAt(time.Now().Add(d)))
+	}
+	id, err := h.q.Send(r.Context(), queue, *body.Payload, options...)
+	if err == q.ErrDuplicate {
+		return httpError{err: err, code: http.StatusConflict}
+	} else if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusAccepted, struct {
+		ID string `json:"id"`
+	}{ID: id})
+	return nil
+}
+
+// putRateLimit sets the rate limit of queue. A zero limit removes it.
+func (h apiHandler) putRateLimit(w http.ResponseWriter, r *http.Request, queue string) error {
+	// The interval is in nanoseconds, as returned by getQueues.
+	var limit q.RateLimit
+	if err := json.NewDecoder(r.Body).Decode(&limit); err != nil {
+		return httpError{err: err, code: http.StatusBadRequest}
+	}
+	if err := h.q.SetRateLimit(r.Context(), queue, limit); err == q.ErrInvalidRateLimit {
+		return httpError{err: err, code: http.StatusBadRequest}
+	} else if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// putConcurrency sets the concurrency limit of queue. A zero limit removes it.
+func (h apiHandler) putConcurrency(w http.ResponseWriter, r *http.Request, queue string) error {
+	var body struct {
+		Limit int64 `json:"limit"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		return httpError{err: err, code: http.StatusBadRequest}
+	}
+	if err := h.q.SetConcurrency(r.Context(), queue, body.Limit); err == q.ErrInvalidConcurrency {
+		return httpError{err: err, code: http.StatusBadRequest}
+	} else if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// getHistory writes the history of queue over the window query parameter, a
+// duration defaulting to an hour.
+func (h apiHandler) getHistory(w http.ResponseWriter, r *http.Request, queue string) error {
+	window := time.Hour
+	if s := r.URL.Query().Get("window"); s != "" {
+		var err error
+		if window, err = time.ParseDuration(s); err != nil {
+			return httpError{err: err, code: http.StatusBadRequest}
+		}
+	}
+	points, err := h.q.History(r.Context(), queue, window)
+	if err != nil {
+		return err
+	}
+	writeJSON(w, http.StatusOK, points)
+	return nil
+}
+
+func (h apiHandler) getFailed(w http.ResponseWriter, r *http.Request) error {
+	query := r.URL.Query()
+	filter, err := parseFailedFilter(query)
+	if err != nil {
+		return httpError{err: err, code: http.StatusBadRequest}
+	}
+	cursor, limit, err := parsePagination(query)
+	if err != nil {
+		return httpError{err: err, code: http.StatusBadRequest}
+	}
+	failed, next, err := h.q.ListFailed(r.Context(), filter, cursor, limit)
+	if err != nil {
+		return err
+	}
+	if failed == nil {
+		failed = []q.Failed{}
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Messages []q.Failed `json:"messages"`
+		Cursor   int64      `json:"cursor"`
+	}{Messages: failed, Cursor: next})
+	return nil
+}
+
+func (h apiHandler) postRetry(w http.ResponseWriter, r *http.Request, s string) error {
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return httpError{err: err, code: http.StatusBadRequest}
+	}
+	if err := h.q.Retry(r.Context(), id); errors.Cause(err) == q.ErrNotFound {
+		return httpError{err: errors.New("failed message not found"), code: http.StatusNotFound}
+	} else if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
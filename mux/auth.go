@@ -0,0 +1,186 @@
+package mux
+
+import (
+	"context"
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Role is the role of a principal. Admins can send messages and change the
+// state of queues and failed messages, read-only principals can only look.
+type Role int
+
+const (
+	RoleReadOnly Role = iota
+	RoleAdmin
+)
+
+// Principal is the authenticated user of a request.
+type Principal struct {
+	Name string
+	Role Role
+}
+
+// Authenticator authenticates a request. It returns ErrUnauthenticated when
+// the request has no valid credentials.
+type Authenticator func(r *http.Request) (Principal, error)
+
+// ErrUnauthenticated is returned by an Authenticator when a request has no
+// valid credentials.
+var ErrUnauthenticated = errors.New("unauthenticated")
+
+// challengeError is ErrUnauthenticated, with the challenges of the
+// WWW-Authenticate header of the response.
+type challengeError struct{ challenges []string }
+
+func (err challengeError) Error() string { return ErrUnauthenticated.Error() }
+func (err challengeError) Cause() error  { return ErrUnauthenticated }
+
+// challenges returns the challenges of err, defaulting to basic
+// authentication.
+func challenges(err error) []string {
+	if err, ok := err.(challengeError); ok && len(err.challenges) > 0 {
+		return err.challenges
+	}
+	return []string{`Basic realm="q"`}
+}
+
+// WithAuth sets the authenticator of the requests. Without authenticator,
+// all requests are allowed as admin.
+func WithAuth(authenticate Authenticator) Option {
+	return func(h *handler) { h.authenticate = authenticate }
+}
+
+// User is a user authenticated by BasicAuth.
+type User struct {
+	Name     string
+	Password string
+	Role     Role
+}
+
+// BasicAuth returns an authenticator of users with HTTP basic authentication.
+func BasicAuth(users ...User) Authenticator {
+	return func(r *http.Request) (Principal, error) {
+		unauthenticated := challengeError{challenges: []string{`Basic realm="q"`}}
+		name, password, ok := r.BasicAuth()
+		if !ok {
+			return Principal{}, unauthenticated
+		}
+		for _, user := range users {
+			if subtle.ConstantTimeCompare([]byte(name), []byte(user.Name)) == 1 &&
+				subtle.ConstantTimeCompare([]byte(password), []byte(user.Password)) == 1 {
+				return Principal{Name: user.Name, Role: user.Role}, nil
+			}
+		}
+		return Principal{}, unauthenticated
+	}
+}
+
+// BearerTokens returns an authenticator of the principals of tokens, sent in
+// the Authorization header.
+func BearerTokens(tokens map[string]Principal) Authenticator {
+	return func(r *http.Request) (Principal, error) {
+		unauthenticated := challengeError{challenges: []string{`Bearer realm="q"`}}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == r.Header.Get("Authorization") {
+			return Principal{}, unauthenticated
+		}
+		for t, principal := range tokens {
+			if subtle.ConstantTimeCompare([]byte(token), []byte(t)) == 1 {
+				return principal, nil
+			}
+		}
+		return Principal{}, unauthenticated
+	}
+}
+
+// AnyOf returns an authenticator trying authenticators in order, until one
+// of them authenticates the request. The response to unauthenticated requests
+// offers the authentication schemes of all authenticators.
+func AnyOf(authenticators ...Authenticator) Authenticator {
+	return func(r *http.Request) (Principal, error) {
+		var unauthenticated challengeError
+		for _, authenticate := range authenticators {
+			principal, err := authenticate(r)
+			if errors.Cause(err) == ErrUnauthenticated {
+				unauthenticated.challenges = append(unauthenticated.challenges, challenges(err)...)
+				continue
+			}
+			return principal, err
+		}
+		return Principal{}, unauthenticated
+	}
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the principal of the request with ctx.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+type errorHandler interface {
+	http.Handler
+	writeError(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// authorize authenticates the requests to next, and only lets admins make
+// requests other than GET and HEAD.
+func (h *handler) authorize(next errorHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal := Principal{Role: RoleAdmin}
+		if h.authenticate != nil {
+			var err error
+			principal, err = h.authenticate(r)
+			if errors.Cause(err) == ErrUnauthenticated {
+				for _, challenge := range challenges(err) {
+					w.Header().Add("WWW-Authenticate", challenge)
+				}
+				next.writeError(w, r, httpError{err: err, code: http.StatusUnauthorized})
+				return
+			} else if err != nil {
+				next.writeError(w, r, err)
+				return
+			}
+		}
+
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && principal.Role != RoleAdmin {
+			next.writeError(w, r, httpError{err: errors.New("admin role required"), code: http.StatusForbidden})
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// Authorize returns next behind the authentication of the handler returned by
+// New with options, for the handlers mounted next to it, like the metrics
+// handler.
+func Authorize(next http.Handler, options ...Option) http.Handler {
+	h := &handler{logger: slog.Default()}
+	for _, option := range options {
+		option(h)
+	}
+	return h.authorize(plainHandler{Handler: next, handler: h})
+}
+
+// plainHandler is an errorHandler writing the errors of handler.
+type plainHandler struct {
+	http.Handler
+	handler *handler
+}
+
+func (h plainHandler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	h.handler.writeError(w, r, err)
+}
+
+// isAdmin returns whether the principal of r is an admin.
+func isAdmin(r *http.Request) bool {
+	principal, ok := PrincipalFromContext(r.Context())
+	return ok && principal.Role == RoleAdmin
+}
@@ -0,0 +1,99 @@
+package mux
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/yansal/q"
+)
+
+// Size of the charts, in pixels.
+const (
+	chartWidth  = 240
+	chartHeight = 60
+)
+
+// chart is a line chart, drawn as an SVG polyline.
+type chart struct {
+	Title  string
+	Last   string
+	Max    string
+	Points string
+}
+
+// activity holds the charts of the last hour and of the last day.
+type activity struct {
+	Hour []chart
+	Day  []chart
+}
+
+// activity returns the charts of queue, or of all queues if queue is empty.
+func (h *handler) activity(ctx context.Context, queue string) (activity, error) {
+	hour, err := h.q.History(ctx, queue, time.Hour)
+	if err != nil {
+		return activity{}, err
+	}
+	day, err := h.q.History(ctx, queue, 24*time.Hour)
+	if err != nil {
+		return activity{}, err
+	}
+	return activity{Hour: charts(hour), Day: charts(day)}, nil
+}
+
+// charts returns the charts of the enqueue rate, the processing rate, the
+// failure rate and the depth of points.
+func charts(points []q.Point) []chart {
+	enqueued := make([]float64, len(points))
+	processed := make([]float64, len(points))
+	failed := make([]float64, len(points))
+	depth := make([]float64, len(points))
+	for i, point := range points {
+		enqueued[i] = float64(point.Enqueued) / point.Step.Seconds()
+		processed[i] = float64(point.Processed) / point.Step.Seconds()
+		if point.Processed > 0 {
+			failed[i] = float64(point.Failed) / float64(point.Processed)
+		}
+		depth[i] = float64(point.Depth)
+	}
+	perSecond := func(f float64) string { return strconv.FormatFloat(f, 'f', 2, 64) + "/s" }
+	return []chart{
+		newChart("enqueued", enqueued, perSecond),
+		newChart("processed", processed, perSecond),
+		newChart("failed", failed, func(f float64) string { return strconv.FormatFloat(100*f, 'f', 1, 64) + "%" }),
+		newChart("depth", depth, func(f float64) string { return strconv.FormatFloat(f, 'f', 0, 64) }),
+	}
+}
+
+func newChart(title string, values []float64, format func(float64) string) chart {
+	var max float64
+	for _, v := range values {
+		if v > max {
+			max = v
+		}
+	}
+	var last float64
+	if len(values) > 0 {
+		last = values[len(values)-1]
+	}
+
+	points := make([]string, len(values))
+	for i, v := range values {
+		x := 0.0
+		if len(values) > 1 {
+			x = float64(i) * chartWidth / float64(len(values)-1)
+		}
+		y := float64(chartHeight)
+		if max > 0 {
+			y -= v / max * chartHeight
+		}
+		points[i] = strconv.FormatFloat(x, 'f', 1, 64) + "," + strconv.FormatFloat(y, 'f', 1, 64)
+	}
+	return chart{
+		Title:  title,
+		Last:   format(last),
+		Max:    format(max),
+		Points: strings.Join(points, " "),
+	}
+}
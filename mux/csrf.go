@@ -0,0 +1,51 @@
+package mux
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// csrfCookie is the name of the cookie holding the CSRF token. The forms of
+// the dashboard send the token back in their csrf field, and servePOST
+// rejects the requests where both differ.
+const csrfCookie = "q_csrf"
+
+// csrfToken returns the CSRF token of r, and sets a new one in a cookie when
+// r has none.
+func (h *handler) csrfToken(w http.ResponseWriter, r *http.Request) (string, error) {
+	if cookie, err := r.Cookie(csrfCookie); err == nil && cookie.Value != "" {
+		return cookie.Value, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", errors.WithStack(err)
+	}
+	token := hex.EncodeToString(b)
+	http.SetCookie(w, &http.Cookie{
+		Name:     csrfCookie,
+		Value:    token,
+		Path:     h.path("/"),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return token, nil
+}
+
+// checkCSRF returns an error when the csrf field of the form of r doesn't
+// match its CSRF cookie.
+func checkCSRF(r *http.Request) error {
+	cookie, err := r.Cookie(csrfCookie)
+	if err != nil || cookie.Value == "" {
+		return httpError{err: errors.New("missing CSRF cookie"), code: http.StatusForbidden}
+	}
+	token := r.PostFormValue("csrf")
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cookie.Value)) != 1 {
+		return httpError{err: errors.New("invalid CSRF token"), code: http.StatusForbidden}
+	}
+	return nil
+}
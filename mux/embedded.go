@@ -1,4 +1,6 @@
 // Code generated by "generate_embedded"; DO NOT EDIT.
 package mux
 
-var indexHTML = "<html>\n<title>Q</title>\n<form method=\"POST\">\n    <input name=\"queue\" placeholder=\"queue\">\n    <input name=\"payload\" placeholder=\"payload\">\n    <button>Send</button>\n</form>\n\n<h1>Queues</h1>\n<table border=\"1\">\n    <tr>\n        <th align=\"center\">name</th>\n        <th align=\"center\">len</th>\n    </tr>\n    {{range $key, $value := .Queues}}\n    <tr valign=\"top\">\n        <td align=\"left\">{{$key}}</td>\n        <td align=\"right\">{{$value}}</td>\n    </tr>\n    {{end}}\n</table>\n\n<h1>Workers</h1>\n<table border=\"1\">\n    <tr>\n        <th align=\"center\">name</th>\n        <th align=\"center\">processed</th>\n        <th align=\"center\">failed</th>\n    </tr>\n    {{range $key, $value := .Workers}}\n    <tr valign=\"top\">\n        <td align=\"left\">{{$key}}</td>\n        <td align=\"right\">{{$value.Processed}}</td>\n        <td align=\"right\">{{$value.Failed}}</td>\n    </tr>\n    {{end}}\n</table>\n\n\n<h1>Failed</h1>\n<table border=\"1\">\n    <tr>\n        <th align=\"center\">payload</th>\n        <th align=\"center\">queue</th>\n        <th align=\"center\">created at</th>\n        <th align=\"center\">run at</th>\n        <th align=\"center\">failed at</th>\n        <th align=\"center\">retried at</th>\n        <th align=\"center\">error</th>\n    </tr>\n    {{range $key, $value := .Failed}}\n    <tr valign=\"top\">\n        <td align=\"left\">{{$value.Payload}}</td>\n        <td align=\"left\">{{$value.Queue}}</td>\n        <td align=\"left\">{{$value.CreatedAt}}</td>\n        <td align=\"left\">{{$value.RunAt}}</td>\n        <td align=\"left\">{{$value.FailedAt}}</td>\n        <td align=\"left\">{{$value.RetriedAt}}</td>\n        <td align=\"left\">\n            <pre>{{$value.Error}}</pre>\n        </td>\n        <td align=\"left\">\n            <form method=\"POST\" action=\"retry\">\n                <input type=\"hidden\" name=\"id\" value=\"{{$key}}\">\n                <button>Retry</button>\n            </form>\n        </td>\n    </tr>\n    {{end}}\n</table>\n\n</html>"
+var indexHTML = "<html>\n<title>Q</title>\n{{if .Admin}}\n<form method=\"POST\" action=\"{{path \"/\"}}\">\n    <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n    <input name=\"queue\" placeholder=\"queue\">\n    <input name=\"payload\" placeholder=\"payload\">\n    <button>Send</button>\n</form>\n{{end}}\n\n<h1>Queues</h1>\n<table border=\"1\" id=\"queues\">\n    <tr>\n        <th align=\"center\">name</th>\n        <th align=\"center\">len</th>\n        <th align=\"center\">processed</th>\n        <th align=\"center\">failed</th>\n        <th align=\"center\">expired</th>\n        <th align=\"center\">last minute</th>\n        <th align=\"center\">last hour</th>\n        <th align=\"center\">last day</th>\n        <th align=\"center\">oldest</th>\n        <th align=\"center\">wait p50 / p90 / p99</th>\n        <th align=\"center\">run p50 / p90 / p99</th>\n        <th align=\"center\">paused</th>\n        <th align=\"center\">rate limit</th>\n        <th align=\"center\">concurrency</th>\n    </tr>\n    {{range $key, $value := .Queues}}\n    <tr valign=\"top\" data-queue=\"{{$key}}\">\n        <td align=\"left\"><a href=\"{{path \"/queue\"}}?queue={{$key}}\">{{$key}}</a></td>\n        <td align=\"right\" data-field=\"len\">{{$value}}</td>\n        {{with index $.QueueStats $key}}\n        <td align=\"right\" data-field=\"processed\">{{.Processed}}</td>\n        <td align=\"right\" data-field=\"failed\">{{.Failed}}</td>\n        <td align=\"right\" data-field=\"expired\">{{.Expired}}</td>\n        <td align=\"right\">{{template \"rate\" .LastMinute}}</td>\n        <td align=\"right\">{{template \"rate\" .LastHour}}</td>\n        <td align=\"right\">{{template \"rate\" .LastDay}}</td>\n        <td align=\"right\">{{round .OldestAge}}</td>\n        <td align=\"right\">{{template \"percentiles\" .WaitTime}}</td>\n        <td align=\"right\">{{template \"percentiles\" .RunTime}}</td>\n        {{end}}\n        <td align=\"center\">{{if index $.Paused $key}}yes{{end}}</td>\n        <td align=\"right\">{{template \"rate limit\" index $.RateLimits $key}}</td>\n        <td align=\"right\">{{with index $.Concurrency $key}}<span data-field=\"leases\">{{(index $.QueueStats $key).Leases}}</span> / {{.}}{{end}}</td>\n        {{if $.Admin}}\n        <td align=\"left\">\n            {{if index $.Paused $key}}\n            <form method=\"POST\" action=\"{{path \"/resume\"}}\">\n                <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n                <input type=\"hidden\" name=\"queue\" value=\"{{$key}}\">\n                <button>Resume</button>\n            </form>\n            {{else}}\n            <form method=\"POST\" action=\"{{path \"/pause\"}}\">\n                <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n                <input type=\"hidden\" name=\"queue\" value=\"{{$key}}\">\n                <button>Pause</button>\n            </form>\n            {{end}}\n            {{$limit := index $.RateLimits $key}}\n            <form method=\"POST\" action=\"{{path \"/rate-limit\"}}\">\n                <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n                <input type=\"hidden\" name=\"queue\" value=\"{{$key}}\">\n                <input name=\"limit\" type=\"number\" min=\"0\" placeholder=\"limit\" value=\"{{with $limit.Limit}}{{.}}{{end}}\">\n                <input name=\"interval\" placeholder=\"interval\" value=\"{{with $limit.Interval}}{{.}}{{end}}\">\n                <button>Rate limit</button>\n            </form>\n            <form method=\"POST\" action=\"{{path \"/concurrency\"}}\">\n                <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n                <input type=\"hidden\" name=\"queue\" value=\"{{$key}}\">\n                <input name=\"limit\" type=\"number\" min=\"0\" placeholder=\"limit\" value=\"{{with index $.Concurrency $key}}{{.}}{{end}}\">\n                <button>Concurrency</button>\n            </form>\n            <form method=\"POST\" action=\"{{path \"/purge\"}}\" onsubmit=\"return confirm('Purge {{$key}}?')\">\n                <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n                <input type=\"hidden\" name=\"queue\" value=\"{{$key}}\">\n                <button>Purge</button>\n            </form>\n            <form method=\"POST\" action=\"{{path \"/delete-queue\"}}\" onsubmit=\"return confirm('Delete {{$key}}?')\">\n                <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n                <input type=\"hidden\" name=\"queue\" value=\"{{$key}}\">\n                <button>Delete</button>\n            </form>\n        </td>\n        {{end}}\n    </tr>\n    {{end}}\n</table>\n\n<h1>Activity</h1>\n{{template \"activity\" .Activity}}\n\n<h1>Workers</h1>\n<table border=\"1\" id=\"workers\">\n    <tr>\n        <th align=\"center\">name</th>\n        <th align=\"center\">queue</th>\n        <th align=\"center\">processed</th>\n        <th align=\"center\">failed</th>\n        <th align=\"center\">message</th>\n        <th align=\"center\">started at</th>\n        <th align=\"center\">elapsed</th>\n    </tr>\n    {{range $key, $value := .Workers}}\n    <tr valign=\"top\" data-worker=\"{{$key}}\" data-message=\"{{with $value.Message}}{{.ID}}{{end}}\">\n        <td align=\"left\"><a href=\"{{path \"/worker\"}}?name={{$key}}\">{{$key}}</a></td>\n        <td align=\"left\"><a href=\"{{path \"/queue\"}}?queue={{$value.Queue}}\">{{$value.Queue}}</a></td>\n        <td align=\"right\" data-field=\"processed\">{{$value.Processed}}</td>\n        <td align=\"right\" data-field=\"failed\">{{$value.Failed}}</td>\n        {{with $value.Message}}\n        <td align=\"left\">{{.ID}}: {{preview .Payload}}</td>\n        <td align=\"left\">{{with .RunAt}}{{.}}{{end}}</td>\n        <td align=\"right\" {{with .RunAt}}data-run-at=\"{{.UnixMilli}}\"{{end}}>{{round $value.Elapsed}}</td>\n        {{else}}\n        <td align=\"left\" colspan=\"3\">idle</td>\n        {{end}}\n    </tr>\n    {{end}}\n</table>\n\n\n<h1>Unique locks</h1>\n<table border=\"1\" id=\"locks\">\n    <tr>\n        <th align=\"center\">key</th>\n        <th align=\"center\">message</th>\n        <th align=\"center\">expires in</th>\n    </tr>\n    {{range .Locks}}\n    <tr valign=\"top\">\n        <td align=\"left\">{{.Key}}</td>\n        <td align=\"left\">{{.MessageID}}</td>\n        <td align=\"right\">{{if .ExpiresAt.IsZero}}never{{else}}{{until .ExpiresAt}}{{end}}</td>\n    </tr>\n    {{end}}\n    {{if .MoreLocks}}\n    <tr>\n        <td colspan=\"3\" align=\"center\">&hellip;</td>\n    </tr>\n    {{end}}\n</table>\n\n<h1>Failed</h1>\n<form method=\"GET\">\n    <input name=\"queue\" placeholder=\"queue\" value=\"{{.Filter.Get \"queue\"}}\">\n    <input name=\"error\" placeholder=\"error\" value=\"{{.Filter.Get \"error\"}}\">\n    <input name=\"since\" type=\"datetime-local\" value=\"{{.Filter.Get \"since\"}}\">\n    <input name=\"until\" type=\"datetime-local\" value=\"{{.Filter.Get \"until\"}}\">\n    <select name=\"retried\">\n        <option value=\"\">retried or not</option>\n        <option value=\"true\" {{if eq (.Filter.Get \"retried\") \"true\"}}selected{{end}}>retried</option>\n        <option value=\"false\" {{if eq (.Filter.Get \"retried\") \"false\"}}selected{{end}}>not retried</option>\n    </select>\n    <button>Filter</button>\n</form>\n{{if .Admin}}\n<form method=\"POST\" action=\"{{path \"/retry-all\"}}\" onsubmit=\"return confirm('Retry all matching failed messages?')\">\n    <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n    {{template \"filter\" .Filter}}\n    <button>Retry all</button>\n</form>\n<form method=\"POST\" action=\"{{path \"/delete\"}}\" onsubmit=\"return confirm('Delete all matching failed messages?')\">\n    <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n    {{template \"filter\" .Filter}}\n    <button>Delete all</button>\n</form>\n{{end}}\n<table border=\"1\" id=\"failed\">\n    <tr>\n        <th align=\"center\">payload</th>\n        <th align=\"center\">queue</th>\n        <th align=\"center\">created at</th>\n        <th align=\"center\">run at</th>\n        <th align=\"center\">failed at</th>\n        <th align=\"center\">retried at</th>\n        <th align=\"center\">error</th>\n    </tr>\n    {{range $value := .Failed}}\n    <tr valign=\"top\">\n        <td align=\"left\">{{$value.Payload}}</td>\n        <td align=\"left\">{{$value.Queue}}</td>\n        <td align=\"left\">{{$value.CreatedAt}}</td>\n        <td align=\"left\">{{$value.RunAt}}</td>\n        <td align=\"left\">{{$value.FailedAt}}</td>\n        <td align=\"left\">{{$value.RetriedAt}}</td>\n        <td align=\"left\">\n            <pre>{{$value.Error}}</pre>\n        </td>\n        {{if $.Admin}}\n        <td align=\"left\">\n            <form method=\"POST\" action=\"{{path \"/retry\"}}\">\n                <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n                <input type=\"hidden\" name=\"id\" value=\"{{$value.FailedID}}\">\n                <button>Retry</button>\n            </form>\n        </td>\n        {{end}}\n    </tr>\n    {{end}}\n</table>\n{{with .Next}}<a href=\"{{.}}\">Next</a>{{end}}\n\n<script>\n(function () {\n    if (!window.EventSource) {\n        return;\n    }\n\n    // refresh replaces the tables with the ones of a freshly rendered page,\n    // when queues or workers come and go or messages fail.\n    var timeout;\n    function refresh() {\n        clearTimeout(timeout);\n        timeout = setTimeout(function () {\n            fetch(location.href).then(function (response) {\n                return response.text();\n            }).then(function (html) {\n                var page = new DOMParser().parseFromString(html, \"text/html\");\n                [\"queues\", \"workers\", \"locks\", \"failed\"].forEach(function (id) {\n                    var table = page.getElementById(id);\n                    if (table) {\n                        document.getElementById(id).replaceWith(table);\n                    }\n                });\n            });\n        }, 500);\n    }\n\n    function update(selector, name, fields) {\n        var row = document.querySelector(\"#\" + selector + \" tr[data-\" + selector.slice(0, -1) + \"=\\\"\" + CSS.escape(name) + \"\\\"]\");\n        if (!row || fields === null) {\n            refresh();\n            return;\n        }\n        Object.keys(fields).forEach(function (field) {\n            var cell = row.querySelector(\"[data-field=\\\"\" + field + \"\\\"]\");\n            if (cell) {\n                cell.textContent = fields[field];\n            }\n        });\n    }\n\n    // since formats the time elapsed since t like time.Duration.String,\n    // rounded to the second.\n    function since(t) {\n        var s = Math.max(0, Math.round((Date.now() - t) / 1000));\n        var h = Math.floor(s / 3600), m = Math.floor(s % 3600 / 60);\n        s %= 60;\n        return (h ? h + \"h\" : \"\") + (h || m ? m + \"m\" : \"\") + s + \"s\";\n    }\n    setInterval(function () {\n        document.querySelectorAll(\"#workers [data-run-at]\").forEach(function (cell) {\n            cell.textContent = since(Number(cell.dataset.runAt));\n        });\n    }, 1000);\n\n    var source = new EventSource({{path \"/events\"}});\n    source.addEventListener(\"stats\", function (e) {\n        var delta = JSON.parse(e.data);\n        Object.keys(delta.queues || {}).forEach(function (name) {\n            var length = delta.queues[name];\n            update(\"queues\", name, length === null ? null : { len: length });\n        });\n        Object.keys(delta.queue_stats || {}).forEach(function (name) {\n            var stats = delta.queue_stats[name];\n            update(\"queues\", name, stats === null ? null : { processed: stats.processed, failed: stats.failed, expired: stats.expired, leases: stats.leases });\n        });\n        Object.keys(delta.workers || {}).forEach(function (name) {\n            var worker = delta.workers[name];\n            var row = document.querySelector(\"#workers tr[data-worker=\\\"\" + CSS.escape(name) + \"\\\"]\");\n            if (worker !== null && row && row.dataset.message !== (worker.message ? worker.message.id : \"\")) {\n                refresh();\n                return;\n            }\n            update(\"workers\", name, worker === null ? null : { processed: worker.processed, failed: worker.failed });\n        });\n        if (Object.keys(delta.paused || {}).length > 0) {\n            refresh();\n        }\n    });\n    [\"worker_started\", \"worker_stopped\", \"message_failed\"].forEach(function (type) {\n        source.addEventListener(type, refresh);\n    });\n})();\n</script>\n\n</html>\n\n{{define \"rate\"}}{{printf \"%.2f\" .Throughput}}/s, {{percent .FailureRate}} failed{{end}}\n\n{{define \"activity\"}}\n<table border=\"1\">\n    <tr>\n        <th align=\"left\">last hour</th>\n        {{range .Hour}}<td>{{template \"chart\" .}}</td>{{end}}\n    </tr>\n    <tr>\n        <th align=\"left\">last day</th>\n        {{range .Day}}<td>{{template \"chart\" .}}</td>{{end}}\n    </tr>\n</table>\n{{end}}\n\n{{define \"chart\"}}\n<div>{{.Title}}: {{.Last}} (max {{.Max}})</div>\n<svg width=\"240\" height=\"60\" viewBox=\"0 0 240 60\">\n    <polyline fill=\"none\" stroke=\"black\" points=\"{{.Points}}\"/>\n</svg>\n{{end}}\n\n{{define \"rate limit\"}}{{if .Limit}}{{.Limit}} / {{.Interval}}{{end}}{{end}}\n\n{{define \"percentiles\"}}{{round .P50}} / {{round .P90}} / {{round .P99}}{{end}}\n\n{{define \"filter\"}}\n<input type=\"hidden\" name=\"queue\" value=\"{{.Get \"queue\"}}\">\n<input type=\"hidden\" name=\"error\" value=\"{{.Get \"error\"}}\">\n<input type=\"hidden\" name=\"since\" value=\"{{.Get \"since\"}}\">\n<input type=\"hidden\" name=\"until\" value=\"{{.Get \"until\"}}\">\n<input type=\"hidden\" name=\"retried\" value=\"{{.Get \"retried\"}}\">\n{{end}}"
+var queueHTML = "<html>\n<title>Q - {{.Queue}}</title>\n<a href=\"{{path \"/\"}}\">Back</a>\n\n<h1>{{.Queue}}</h1>\n<table border=\"1\">\n    <tr>\n        <th align=\"center\">len</th>\n        <th align=\"center\">processed</th>\n        <th align=\"center\">failed</th>\n        <th align=\"center\">expired</th>\n        <th align=\"center\">last minute</th>\n        <th align=\"center\">last hour</th>\n        <th align=\"center\">last day</th>\n        <th align=\"center\">oldest</th>\n        <th align=\"center\">wait p50 / p90 / p99</th>\n        <th align=\"center\">run p50 / p90 / p99</th>\n        <th align=\"center\">paused</th>\n        <th align=\"center\">rate limit</th>\n        <th align=\"center\">concurrency</th>\n    </tr>\n    <tr valign=\"top\">\n        <td align=\"right\">{{.Length}}</td>\n        {{with .Stats}}\n        <td align=\"right\">{{.Processed}}</td>\n        <td align=\"right\">{{.Failed}}</td>\n        <td align=\"right\">{{.Expired}}</td>\n        <td align=\"right\">{{template \"rate\" .LastMinute}}</td>\n        <td align=\"right\">{{template \"rate\" .LastHour}}</td>\n        <td align=\"right\">{{template \"rate\" .LastDay}}</td>\n        <td align=\"right\">{{round .OldestAge}}</td>\n        <td align=\"right\">{{template \"percentiles\" .WaitTime}}</td>\n        <td align=\"right\">{{template \"percentiles\" .RunTime}}</td>\n        {{end}}\n        <td align=\"center\">{{if .Paused}}yes{{end}}</td>\n        <td align=\"right\">{{template \"rate limit\" .RateLimit}}</td>\n        <td align=\"right\">{{with .Concurrency}}{{$.Stats.Leases}} / {{.}}{{end}}</td>\n    </tr>\n</table>\n{{if .Admin}}\n{{if .Paused}}\n<form method=\"POST\" action=\"{{path \"/resume\"}}\">\n    <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n    <input type=\"hidden\" name=\"queue\" value=\"{{.Queue}}\">\n    <input type=\"hidden\" name=\"redirect\" value=\"{{.Self}}\">\n    <button>Resume</button>\n</form>\n{{else}}\n<form method=\"POST\" action=\"{{path \"/pause\"}}\">\n    <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n    <input type=\"hidden\" name=\"queue\" value=\"{{.Queue}}\">\n    <input type=\"hidden\" name=\"redirect\" value=\"{{.Self}}\">\n    <button>Pause</button>\n</form>\n{{end}}\n<form method=\"POST\" action=\"{{path \"/rate-limit\"}}\">\n    <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n    <input type=\"hidden\" name=\"queue\" value=\"{{.Queue}}\">\n    <input type=\"hidden\" name=\"redirect\" value=\"{{.Self}}\">\n    <input name=\"limit\" type=\"number\" min=\"0\" placeholder=\"limit\" value=\"{{with .RateLimit.Limit}}{{.}}{{end}}\">\n    <input name=\"interval\" placeholder=\"interval\" value=\"{{with .RateLimit.Interval}}{{.}}{{end}}\">\n    <button>Rate limit</button>\n</form>\n<form method=\"POST\" action=\"{{path \"/concurrency\"}}\">\n    <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n    <input type=\"hidden\" name=\"queue\" value=\"{{.Queue}}\">\n    <input type=\"hidden\" name=\"redirect\" value=\"{{.Self}}\">\n    <input name=\"limit\" type=\"number\" min=\"0\" placeholder=\"limit\" value=\"{{with .Concurrency}}{{.}}{{end}}\">\n    <button>Concurrency</button>\n</form>\n<form method=\"POST\" action=\"{{path \"/purge\"}}\" onsubmit=\"return confirm('Purge {{.Queue}}?')\">\n    <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n    <input type=\"hidden\" name=\"queue\" value=\"{{.Queue}}\">\n    <input type=\"hidden\" name=\"redirect\" value=\"{{.Self}}\">\n    <button>Purge</button>\n</form>\n<form method=\"POST\" action=\"{{path \"/delete-queue\"}}\" onsubmit=\"return confirm('Delete {{.Queue}}?')\">\n    <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n    <input type=\"hidden\" name=\"queue\" value=\"{{.Queue}}\">\n    <button>Delete</button>\n</form>\n{{end}}\n\n<h2>Activity</h2>\n{{template \"activity\" .Activity}}\n\n<h2>Pending</h2>\n<table border=\"1\">\n    <tr>\n        <th align=\"center\">id</th>\n        <th align=\"center\">payload</th>\n        <th align=\"center\">created at</th>\n        <th align=\"center\">age</th>\n    </tr>\n    {{range $value := .Messages}}\n    <tr valign=\"top\">\n        <td align=\"left\">{{$value.ID}}</td>\n        <td align=\"left\">\n            <pre>{{$value.Payload}}</pre>\n        </td>\n        <td align=\"left\">{{$value.CreatedAt}}</td>\n        <td align=\"right\">{{since $value.CreatedAt}}</td>\n        <td align=\"left\">\n            {{if and $.Admin $value.ID}}\n            <form method=\"POST\" action=\"{{path \"/delete-pending\"}}\">\n                <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n                <input type=\"hidden\" name=\"queue\" value=\"{{$.Queue}}\">\n                <input type=\"hidden\" name=\"id\" value=\"{{$value.ID}}\">\n                <button>Delete</button>\n            </form>\n            <form method=\"POST\" action=\"{{path \"/move-pending\"}}\">\n                <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n                <input type=\"hidden\" name=\"queue\" value=\"{{$.Queue}}\">\n                <input type=\"hidden\" name=\"id\" value=\"{{$value.ID}}\">\n                <input name=\"to\" placeholder=\"queue\">\n                <button>Move</button>\n            </form>\n            {{end}}\n        </td>\n    </tr>\n    {{end}}\n</table>\n{{with .Next}}<a href=\"{{.}}\">Next</a>{{end}}\n\n<h2>Failed</h2>\n<table border=\"1\">\n    <tr>\n        <th align=\"center\">payload</th>\n        <th align=\"center\">created at</th>\n        <th align=\"center\">failed at</th>\n        <th align=\"center\">retried at</th>\n        <th align=\"center\">error</th>\n    </tr>\n    {{range $value := .Failed}}\n    <tr valign=\"top\">\n        <td align=\"left\">{{$value.Payload}}</td>\n        <td align=\"left\">{{$value.CreatedAt}}</td>\n        <td align=\"left\">{{$value.FailedAt}}</td>\n        <td align=\"left\">{{$value.RetriedAt}}</td>\n        <td align=\"left\">\n            <pre>{{$value.Error}}</pre>\n        </td>\n        {{if $.Admin}}\n        <td align=\"left\">\n            <form method=\"POST\" action=\"{{path \"/retry\"}}\">\n                <input type=\"hidden\" name=\"csrf\" value=\"{{$.CSRF}}\">\n                <input type=\"hidden\" name=\"id\" value=\"{{$value.FailedID}}\">\n                <input type=\"hidden\" name=\"redirect\" value=\"{{$.Self}}\">\n                <button>Retry</button>\n            </form>\n        </td>\n        {{end}}\n    </tr>\n    {{end}}\n</table>\n{{if .MoreFailed}}<a href=\"{{path \"/\"}}?queue={{.Queue}}\">All failed</a>{{end}}\n\n</html>\n"
+var workerHTML = "<html>\n<title>Q - {{.Name}}</title>\n<a href=\"{{path \"/\"}}\">Back</a>\n\n<h1>{{.Name}}</h1>\n{{with .Worker}}\n<table border=\"1\">\n    <tr>\n        <th align=\"left\">host</th>\n        <td align=\"left\">{{.Host}}</td>\n    </tr>\n    <tr>\n        <th align=\"left\">pid</th>\n        <td align=\"left\">{{.PID}}</td>\n    </tr>\n    <tr>\n        <th align=\"left\">queue</th>\n        <td align=\"left\"><a href=\"{{path \"/queue\"}}?queue={{.Queue}}\">{{.Queue}}</a></td>\n    </tr>\n    <tr>\n        <th align=\"left\">started at</th>\n        <td align=\"left\">{{.StartedAt}}</td>\n    </tr>\n    <tr>\n        <th align=\"left\">uptime</th>\n        <td align=\"left\">{{since .StartedAt}}</td>\n    </tr>\n    <tr>\n        <th align=\"left\">heartbeat</th>\n        <td align=\"left\">{{since .Heartbeat}} ago</td>\n    </tr>\n    <tr>\n        <th align=\"left\">processed</th>\n        <td align=\"left\">{{.Processed}}</td>\n    </tr>\n    <tr>\n        <th align=\"left\">failed</th>\n        <td align=\"left\">{{.Failed}}</td>\n    </tr>\n</table>\n\n<h2>Current message</h2>\n{{with .Message}}\n<table border=\"1\">\n    <tr>\n        <th align=\"center\">id</th>\n        <th align=\"center\">queue</th>\n        <th align=\"center\">payload</th>\n        <th align=\"center\">created at</th>\n        <th align=\"center\">started at</th>\n        <th align=\"center\">elapsed</th>\n    </tr>\n    <tr valign=\"top\">\n        <td align=\"left\">{{.ID}}</td>\n        <td align=\"left\"><a href=\"{{path \"/queue\"}}?queue={{.Queue}}\">{{.Queue}}</a></td>\n        <td align=\"left\">\n            <pre>{{.Payload}}</pre>\n        </td>\n        <td align=\"left\">{{.CreatedAt}}</td>\n        <td align=\"left\">{{with .RunAt}}{{.}}{{end}}</td>\n        <td align=\"right\">{{round $.Worker.Elapsed}}</td>\n    </tr>\n</table>\n{{else}}\n<p>Idle</p>\n{{end}}\n{{end}}\n\n</html>\n"
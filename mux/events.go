@@ -0,0 +1,146 @@
+package mux
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/yansal/q"
+)
+
+// statsInterval is the interval between two stats deltas pushed by the
+// events handler.
+const statsInterval = 2 * time.Second
+
+// serveEvents streams server-sent events: the events published by workers
+// and, every statsInterval, a stats event holding what changed since the
+// previous one. Removed queues and workers are set to null.
+func (h *handler) serveEvents(w http.ResponseWriter, r *http.Request) error {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		return errors.New("streaming is not supported")
+	}
+	ctx := r.Context()
+
+	events, err := h.q.Events(ctx)
+	if err != nil {
+		return err
+	}
+	previous, err := h.q.Stats(ctx)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	ticker := time.NewTicker(statsInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return nil
+			}
+			if err := writeEvent(w, event.Type, event); err != nil {
+				return nil
+			}
+		case <-ticker.C:
+			stats, err := h.q.Stats(ctx)
+			if err != nil {
+				h.logger.Error("getting stats failed", "error", fmt.Sprintf("%+v", err))
+				continue
+			}
+			delta, changed := diffStats(previous, stats)
+			previous = stats
+			if !changed {
+				continue
+			}
+			if err := writeEvent(w, "stats", delta); err != nil {
+				return nil
+			}
+		}
+		flusher.Flush()
+	}
+}
+
+func writeEvent(w http.ResponseWriter, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return errors.WithStack(err)
+}
+
+type statsDelta struct {
+	Queues     map[string]*int64        `json:"queues,omitempty"`
+	Paused     map[string]*bool         `json:"paused,omitempty"`
+	QueueStats map[string]*q.QueueStats `json:"queue_stats,omitempty"`
+	Workers    map[string]*q.Worker     `json:"workers,omitempty"`
+	Stats      interface{}              `json:"stats,omitempty"`
+}
+
+func diffStats(previous, current q.Stats) (statsDelta, bool) {
+	var delta statsDelta
+	changed := false
+
+	delta.Queues = make(map[string]*int64)
+	for name := range previous.Queues {
+		if _, ok := current.Queues[name]; !ok {
+			delta.Queues[name] = nil
+		}
+	}
+	for name, length := range current.Queues {
+		if old, ok := previous.Queues[name]; !ok || old != length {
+			delta.Queues[name] = &length
+		}
+	}
+
+	delta.Paused = make(map[string]*bool)
+	for name := range current.Queues {
+		if previous.Paused[name] != current.Paused[name] {
+			paused := current.Paused[name]
+			delta.Paused[name] = &paused
+		}
+	}
+
+	delta.QueueStats = make(map[string]*q.QueueStats)
+	for name := range previous.QueueStats {
+		if _, ok := current.QueueStats[name]; !ok {
+			delta.QueueStats[name] = nil
+		}
+	}
+	for name, stats := range current.QueueStats {
+		if old, ok := previous.QueueStats[name]; !ok || !reflect.DeepEqual(old, stats) {
+			delta.QueueStats[name] = &stats
+		}
+	}
+
+	delta.Workers = make(map[string]*q.Worker)
+	for name := range previous.Workers {
+		if _, ok := current.Workers[name]; !ok {
+			delta.Workers[name] = nil
+		}
+	}
+	for name, worker := range current.Workers {
+		if old, ok := previous.Workers[name]; !ok || !reflect.DeepEqual(old, worker) {
+			delta.Workers[name] = &worker
+		}
+	}
+
+	if previous.Stats != current.Stats {
+		delta.Stats = current.Stats
+		changed = true
+	}
+	changed = changed || len(delta.Queues) > 0 || len(delta.Paused) > 0 ||
+		len(delta.QueueStats) > 0 || len(delta.Workers) > 0
+	return delta, changed
+}
@@ -16,15 +16,24 @@ func main() {
 	}
 }
 
+var files = []struct{ name, variable string }{
+	{name: "index.html", variable: "indexHTML"},
+	{name: "queue.html", variable: "queueHTML"},
+	{name: "worker.html", variable: "workerHTML"},
+}
+
 func generate() error {
-	b, err := ioutil.ReadFile("index.html")
-	if err != nil {
-		return err
-	}
 	var buf bytes.Buffer
-	fmt.Fprintf(&buf, `// Code generated by "generate_embedded"; DO NOT EDIT.
+	fmt.Fprint(&buf, `// Code generated by "generate_embedded"; DO NOT EDIT.
 package mux
-var indexHTML = %q`, b)
+`)
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file.name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(&buf, "var %s = %q\n", file.variable, b)
+	}
 	fmtbuf, err := format.Source(buf.Bytes())
 	if err != nil {
 		return err
@@ -3,44 +3,120 @@
 package mux
 
 import (
+	"context"
+	"fmt"
 	"html/template"
-	"log"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/pkg/errors"
 	"github.com/yansal/q"
 )
 
-func New(q q.Q) (*http.ServeMux, error) {
-	template, err := template.New("").Parse(indexHTML)
+var funcs = template.FuncMap{
+	"since":   func(t time.Time) time.Duration { return time.Since(t).Round(time.Second) },
+	"until":   func(t time.Time) time.Duration { return time.Until(t).Round(time.Second) },
+	"round":   func(d time.Duration) time.Duration { return d.Round(time.Millisecond) },
+	"percent": func(f float64) string { return strconv.FormatFloat(100*f, 'f', 1, 64) + "%" },
+	"preview": preview,
+}
+
+// previewLength is the number of characters of the payloads previewed.
+const previewLength = 40
+
+func preview(payload string) string {
+	runes := []rune(payload)
+	if len(runes) <= previewLength {
+		return payload
+	}
+	return string(runes[:previewLength]) + "…"
+}
+
+// Option configures the handler returned by New.
+type Option func(*handler)
+
+// WithLogger sets the logger of the errors returned by the handlers. It
+// defaults to slog.Default().
+func WithLogger(logger q.Logger) Option {
+	return func(h *handler) { h.logger = logger }
+}
+
+// WithPrefix sets the path prefix the handler is mounted under, e.g.
+// /admin/q. The links and redirects of the dashboard, and the routes of the
+// returned mux, start with prefix.
+func WithPrefix(prefix string) Option {
+	return func(h *handler) { h.prefix = strings.TrimSuffix(prefix, "/") }
+}
+
+func New(q q.Q, options ...Option) (*http.ServeMux, error) {
+	h := &handler{q: q, logger: slog.Default()}
+	for _, option := range options {
+		option(h)
+	}
+
+	template, err := template.New("index").Funcs(funcs).Funcs(template.FuncMap{"path": h.path}).Parse(indexHTML)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	if _, err := template.New("queue").Parse(queueHTML); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if _, err := template.New("worker").Parse(workerHTML); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	h.template = template
 
 	mux := http.NewServeMux()
-	mux.Handle("/", &handler{q: q, template: template})
+	mux.Handle(h.path("/"), http.StripPrefix(h.prefix, h.authorize(h)))
+	mux.Handle(h.path("/api/"), http.StripPrefix(h.prefix, h.authorize(apiHandler{h})))
 	return mux, nil
 }
 
-type handlerFunc func(w http.ResponseWriter, r *http.Request) error
+// path returns the path of p under the prefix of h.
+func (h *handler) path(p string) string { return h.prefix + p }
 
-func handleError(h handlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if err := h(w, r); err != nil {
-			log.Printf("%+v", err)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+type httpError struct {
+	err  error
+	code int
+}
+
+func (e httpError) Error() string { return e.err.Error() }
+
+// httpError returns err as an httpError. Other errors are logged and
+// returned as internal server errors.
+func (h *handler) httpError(r *http.Request, err error) httpError {
+	herr, ok := err.(httpError)
+	if !ok {
+		h.logger.Error("request failed", "method", r.Method, "path", r.URL.Path, "error", fmt.Sprintf("%+v", err))
+		herr = httpError{err: err, code: http.StatusInternalServerError}
 	}
+	if herr.err == nil {
+		herr.err = errors.New(http.StatusText(herr.code))
+	}
+	return herr
+}
+
+func (h *handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	herr := h.httpError(r, err)
+	http.Error(w, herr.Error(), herr.code)
 }
 
 type handler struct {
-	q        q.Q
-	template *template.Template
+	q            q.Q
+	template     *template.Template
+	logger       q.Logger
+	authenticate Authenticator
+	prefix       string
 }
 
 func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	handleError(h.serveHTTP)(w, r)
+	if err := h.serveHTTP(w, r); err != nil {
+		h.writeError(w, r, err)
+	}
 }
 
 func (h *handler) serveHTTP(w http.ResponseWriter, r *http.Request) error {
@@ -56,22 +132,256 @@ func (h *handler) serveHTTP(w http.ResponseWriter, r *http.Request) error {
 	}
 }
 
+// defaultLimit is the number of failed messages displayed per page.
+const defaultLimit = 20
+
+// lockLimit is the number of unique locks displayed on the index page, the
+// first to expire.
+const lockLimit = 20
+
+type page struct {
+	q.Stats
+	Activity activity
+	Locks    []q.Lock
+	// MoreLocks is true when more than the displayed Locks are held.
+	MoreLocks bool
+	Failed    []q.Failed
+	Filter    url.Values
+	Next      string
+	Admin     bool
+	CSRF      string
+}
+
 func (h *handler) serveGET(w http.ResponseWriter, r *http.Request) error {
+	switch r.URL.Path {
+	case "/":
+		return h.serveIndex(w, r)
+	case "/queue", "/pending":
+		return h.serveQueue(w, r)
+	case "/worker":
+		return h.serveWorker(w, r)
+	case "/events":
+		return h.serveEvents(w, r)
+	default:
+		status := http.StatusNotFound
+		http.Error(w, http.StatusText(status), status)
+		return nil
+	}
+}
+
+func (h *handler) serveIndex(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
+	query := r.URL.Query()
+	filter, err := parseFailedFilter(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	cursor, limit, err := parsePagination(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
 	stats, err := h.q.Stats(ctx)
 	if err != nil {
 		return err
 	}
-	return errors.WithStack(h.template.Execute(w, stats))
+	activity, err := h.activity(ctx, "")
+	if err != nil {
+		return err
+	}
+	locks, moreLocks, err := h.q.Locks(ctx, 0, lockLimit)
+	if err != nil {
+		return err
+	}
+	failed, next, err := h.q.ListFailed(ctx, filter, cursor, limit)
+	if err != nil {
+		return err
+	}
+
+	token, err := h.csrfToken(w, r)
+	if err != nil {
+		return err
+	}
+
+	page := page{Stats: stats, Activity: activity, Locks: locks, MoreLocks: moreLocks != 0, Failed: failed, Filter: query, Next: nextPage(query, next), Admin: isAdmin(r), CSRF: token}
+	return errors.WithStack(h.template.ExecuteTemplate(w, "index", page))
+}
+
+type queuePage struct {
+	Queue       string
+	Self        string
+	Length      int64
+	Paused      bool
+	RateLimit   q.RateLimit
+	Concurrency int64
+	Stats       q.QueueStats
+	Activity    activity
+	Messages    []q.Message
+	Next        string
+	Failed      []q.Failed
+	MoreFailed  bool
+	Admin       bool
+	CSRF        string
+}
+
+func (h *handler) serveQueue(w http.ResponseWriter, r *http.Request) error {
+	ctx := r.Context()
+	query := r.URL.Query()
+	queue := query.Get("queue")
+	if queue == "" {
+		http.Error(w, "queue is required", http.StatusBadRequest)
+		return nil
+	}
+	cursor, limit, err := parsePagination(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+
+	stats, err := h.q.Stats(ctx, queue)
+	if err != nil {
+		return err
+	}
+	activity, err := h.activity(ctx, queue)
+	if err != nil {
+		return err
+	}
+	messages, next, err := h.q.ListPending(ctx, queue, cursor, limit)
+	if err != nil {
+		return err
+	}
+	failed, moreFailed, err := h.q.ListFailed(ctx, q.FailedFilter{Queue: queue}, 0, defaultLimit)
+	if err != nil {
+		return err
+	}
+	token, err := h.csrfToken(w, r)
+	if err != nil {
+		return err
+	}
+	page := queuePage{
+		Queue:       queue,
+		Self:        h.path("/queue?queue=") + url.QueryEscape(queue),
+		Length:      stats.Queues[queue],
+		Paused:      stats.Paused[queue],
+		RateLimit:   stats.RateLimits[queue],
+		Concurrency: stats.Concurrency[queue],
+		Stats:       stats.QueueStats[queue],
+		Activity:    activity,
+		Messages:    messages,
+		Next:        nextPage(query, next),
+		Failed:      failed,
+		MoreFailed:  moreFailed != 0,
+		Admin:       isAdmin(r),
+		CSRF:        token,
+	}
+	return errors.WithStack(h.template.ExecuteTemplate(w, "queue", page))
+}
+
+type workerPage struct {
+	Name   string
+	Worker q.Worker
+}
+
+func (h *handler) serveWorker(w http.ResponseWriter, r *http.Request) error {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return nil
+	}
+	worker, err := h.q.Worker(r.Context(), name)
+	if errors.Cause(err) == q.ErrNotFound {
+		http.Error(w, "worker not found", http.StatusNotFound)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	page := workerPage{Name: name, Worker: worker}
+	return errors.WithStack(h.template.ExecuteTemplate(w, "worker", page))
+}
+
+// nextPage returns the link to the page of query starting at cursor, or an
+// empty string if cursor is 0.
+func nextPage(query url.Values, cursor int64) string {
+	if cursor == 0 {
+		return ""
+	}
+	values := make(url.Values, len(query))
+	for k, v := range query {
+		values[k] = v
+	}
+	values.Set("cursor", strconv.FormatInt(cursor, 10))
+	return "?" + values.Encode()
+}
+
+func parseFailedFilter(values url.Values) (q.FailedFilter, error) {
+	filter := q.FailedFilter{
+		Queue: values.Get("queue"),
+		Error: values.Get("error"),
+	}
+	var err error
+	if s := values.Get("since"); s != "" {
+		if filter.Since, err = parseTime(s); err != nil {
+			return filter, err
+		}
+	}
+	if s := values.Get("until"); s != "" {
+		if filter.Until, err = parseTime(s); err != nil {
+			return filter, err
+		}
+	}
+	if s := values.Get("retried"); s != "" {
+		retried, err := strconv.ParseBool(s)
+		if err != nil {
+			return filter, errors.WithStack(err)
+		}
+		filter.Retried = &retried
+	}
+	return filter, nil
+}
+
+// parseTime parses s as RFC 3339 or as the value of a datetime-local input.
+func parseTime(s string) (time.Time, error) {
+	t, err := time.Parse(time.RFC3339, s)
+	if err == nil {
+		return t, nil
+	}
+	t, err = time.ParseInLocation("2006-01-02T15:04", s, time.Local)
+	return t, errors.WithStack(err)
+}
+
+func parsePagination(values url.Values) (int64, int64, error) {
+	var cursor int64
+	limit := int64(defaultLimit)
+	var err error
+	if s := values.Get("cursor"); s != "" {
+		if cursor, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, 0, errors.WithStack(err)
+		}
+	}
+	if s := values.Get("limit"); s != "" {
+		if limit, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return 0, 0, errors.WithStack(err)
+		}
+	}
+	return cursor, limit, nil
 }
 
 func (h *handler) servePOST(w http.ResponseWriter, r *http.Request) error {
 	ctx := r.Context()
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil
+	}
+	if err := checkCSRF(r); err != nil {
+		return err
+	}
 	switch r.URL.Path {
 	case "/":
 		queue := r.FormValue("queue")
 		payload := r.FormValue("payload")
-		if err := h.q.Send(ctx, queue, payload); err != nil {
+		if _, err := h.q.Send(ctx, queue, payload); err != nil {
 			return err
 		}
 	case "/retry":
@@ -81,7 +391,114 @@ func (h *handler) servePOST(w http.ResponseWriter, r *http.Request) error {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return nil
 		}
-		if err := h.q.Retry(ctx, id); err != nil {
+		if err := h.q.Retry(ctx, id); errors.Cause(err) == q.ErrNotFound {
+			http.Error(w, "failed message not found", http.StatusNotFound)
+			return nil
+		} else if err != nil {
+			return err
+		}
+	case "/pause", "/resume", "/purge", "/delete-queue":
+		queue := r.FormValue("queue")
+		if queue == "" {
+			http.Error(w, "queue is required", http.StatusBadRequest)
+			return nil
+		}
+		action := map[string]func(context.Context, string) error{
+			"/pause":        h.q.Pause,
+			"/resume":       h.q.Resume,
+			"/purge":        h.q.Purge,
+			"/delete-queue": h.q.DeleteQueue,
+		}[r.URL.Path]
+		if err := action(ctx, queue); err != nil {
+			return err
+		}
+	case "/rate-limit":
+		queue := r.FormValue("queue")
+		if queue == "" {
+			http.Error(w, "queue is required", http.StatusBadRequest)
+			return nil
+		}
+		var limit q.RateLimit
+		var err error
+		if s := r.FormValue("limit"); s != "" {
+			if limit.Limit, err = strconv.ParseInt(s, 10, 64); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return nil
+			}
+		}
+		if s := r.FormValue("interval"); s != "" && limit.Limit != 0 {
+			if limit.Interval, err = time.ParseDuration(s); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return nil
+			}
+		}
+		if err := h.q.SetRateLimit(ctx, queue, limit); err == q.ErrInvalidRateLimit {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		} else if err != nil {
+			return err
+		}
+	case "/concurrency":
+		queue := r.FormValue("queue")
+		if queue == "" {
+			http.Error(w, "queue is required", http.StatusBadRequest)
+			return nil
+		}
+		var limit int64
+		if s := r.FormValue("limit"); s != "" {
+			var err error
+			if limit, err = strconv.ParseInt(s, 10, 64); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return nil
+			}
+		}
+		if err := h.q.SetConcurrency(ctx, queue, limit); err == q.ErrInvalidConcurrency {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		} else if err != nil {
+			return err
+		}
+	case "/delete-pending", "/move-pending":
+		queue, id := r.FormValue("queue"), r.FormValue("id")
+		if queue == "" || id == "" {
+			http.Error(w, "queue and id are required", http.StatusBadRequest)
+			return nil
+		}
+		var err error
+		if r.URL.Path == "/delete-pending" {
+			err = h.q.DeletePending(ctx, queue, id)
+		} else {
+			to := r.FormValue("to")
+			if to == "" {
+				http.Error(w, "to is required", http.StatusBadRequest)
+				return nil
+			}
+			err = h.q.MovePending(ctx, queue, id, to)
+		}
+		if errors.Cause(err) == q.ErrNotFound {
+			http.Error(w, "pending message not found", http.StatusNotFound)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		http.Redirect(w, r, h.path("/queue?queue=")+url.QueryEscape(queue), http.StatusFound)
+		return nil
+	case "/retry-all":
+		filter, err := parseFailedFilter(r.Form)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		}
+		if _, err := h.q.RetryAll(ctx, filter); err != nil {
+			return err
+		}
+	case "/delete":
+		filter, err := parseFailedFilter(r.Form)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return nil
+		}
+		if _, err := h.q.DeleteFailed(ctx, filter); err != nil {
 			return err
 		}
 	default:
@@ -89,6 +506,16 @@ func (h *handler) servePOST(w http.ResponseWriter, r *http.Request) error {
 		http.Error(w, http.StatusText(status), status)
 		return nil
 	}
-	http.Redirect(w, r, "", http.StatusFound)
+	http.Redirect(w, r, h.redirect(r), http.StatusFound)
 	return nil
 }
+
+// redirect returns the page to redirect to after a POST: the redirect field
+// of the form when it is a page of the dashboard, or the index.
+func (h *handler) redirect(r *http.Request) string {
+	redirect := r.FormValue("redirect")
+	if !strings.HasPrefix(redirect, h.path("/")) || strings.HasPrefix(redirect, "//") || strings.Contains(redirect, "\\") {
+		return h.path("/")
+	}
+	return redirect
+}
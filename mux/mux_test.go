@@ -0,0 +1,230 @@
+package mux
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/yansal/q"
+)
+
+// stubQ is a q.Q recording the queues paused. The methods it doesn't
+// implement panic.
+type stubQ struct {
+	q.Q
+	paused []string
+}
+
+func (s *stubQ) Pause(ctx context.Context, queue string) error {
+	s.paused = append(s.paused, queue)
+	return nil
+}
+
+func (s *stubQ) Stats(ctx context.Context, queues ...string) (q.Stats, error) {
+	return q.Stats{}, nil
+}
+
+func (s *stubQ) SetRateLimit(ctx context.Context, queue string, limit q.RateLimit) error {
+	return nil
+}
+
+func newTestMux(t *testing.T, options ...Option) (*http.ServeMux, *stubQ) {
+	t.Helper()
+	stub := &stubQ{}
+	mux, err := New(stub, options...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mux, stub
+}
+
+const testCSRF = "token"
+
+// postForm returns a POST request of form, with the CSRF cookie testCSRF.
+func postForm(target string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, target, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.AddCookie(&http.Cookie{Name: csrfCookie, Value: testCSRF})
+	return r
+}
+
+func TestCSRF(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		cookie bool
+		token  string
+		code   int
+	}{
+		{name: "missing cookie", token: testCSRF, code: http.StatusForbidden},
+		{name: "missing token", cookie: true, code: http.StatusForbidden},
+		{name: "mismatched token", cookie: true, token: "other", code: http.StatusForbidden},
+		{name: "matching token", cookie: true, token: testCSRF, code: http.StatusFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mux, stub := newTestMux(t)
+			form := url.Values{"queue": {"a"}}
+			if tt.token != "" {
+				form.Set("csrf", tt.token)
+			}
+			r := postForm("/pause", form)
+			if !tt.cookie {
+				r.Header.Del("Cookie")
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != tt.code {
+				t.Errorf("got status %d, want %d", w.Code, tt.code)
+			}
+			if paused := len(stub.paused) == 1; paused != (tt.code == http.StatusFound) {
+				t.Errorf("got paused %v", stub.paused)
+			}
+		})
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	auth := WithAuth(BasicAuth(
+		User{Name: "reader", Password: "secret", Role: RoleReadOnly},
+		User{Name: "admin", Password: "secret", Role: RoleAdmin},
+	))
+	for _, tt := range []struct {
+		name string
+		user string
+		r    func() *http.Request
+		code int
+	}{
+		{
+			name: "POST",
+			user: "reader",
+			r:    func() *http.Request { return postForm("/pause", url.Values{"queue": {"a"}, "csrf": {testCSRF}}) },
+			code: http.StatusForbidden,
+		},
+		{
+			name: "PUT",
+			user: "reader",
+			r: func() *http.Request {
+				return httptest.NewRequest(http.MethodPut, "/api/v1/queues/a/rate-limit", strings.NewReader(`{"limit":1,"interval":1000000000}`))
+			},
+			code: http.StatusForbidden,
+		},
+		{
+			name: "GET",
+			user: "reader",
+			r:    func() *http.Request { return httptest.NewRequest(http.MethodGet, "/api/v1/stats", nil) },
+			code: http.StatusOK,
+		},
+		{
+			name: "admin POST",
+			user: "admin",
+			r:    func() *http.Request { return postForm("/pause", url.Values{"queue": {"a"}, "csrf": {testCSRF}}) },
+			code: http.StatusFound,
+		},
+		{
+			name: "admin PUT",
+			user: "admin",
+			r: func() *http.Request {
+				return httptest.NewRequest(http.MethodPut, "/api/v1/queues/a/rate-limit", strings.NewReader(`{"limit":1,"interval":1000000000}`))
+			},
+			code: http.StatusNoContent,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mux, stub := newTestMux(t, auth)
+			r := tt.r()
+			r.SetBasicAuth(tt.user, "secret")
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != tt.code {
+				t.Errorf("got status %d, want %d", w.Code, tt.code)
+			}
+			if tt.code == http.StatusForbidden && len(stub.paused) > 0 {
+				t.Errorf("got paused %v", stub.paused)
+			}
+		})
+	}
+}
+
+func TestRedirect(t *testing.T) {
+	for _, tt := range []struct {
+		prefix   string
+		redirect string
+		location string
+	}{
+		{redirect: "", location: "/"},
+		{redirect: "/queue?queue=a", location: "/queue?queue=a"},
+		{redirect: "//evil", location: "/"},
+		{redirect: "//evil/", location: "/"},
+		{redirect: `/\evil`, location: "/"},
+		{redirect: "https://evil", location: "/"},
+		{redirect: "evil", location: "/"},
+		{prefix: "/admin/q", redirect: "/admin/q/queue?queue=a", location: "/admin/q/queue?queue=a"},
+		{prefix: "/admin/q", redirect: "/queue?queue=a", location: "/admin/q/"},
+		{prefix: "/admin/q", redirect: `/admin/q/\evil`, location: "/admin/q/"},
+	} {
+		t.Run(tt.prefix+tt.redirect, func(t *testing.T) {
+			mux, _ := newTestMux(t, WithPrefix(tt.prefix))
+			r := postForm(tt.prefix+"/pause", url.Values{"queue": {"a"}, "csrf": {testCSRF}, "redirect": {tt.redirect}})
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, r)
+			if w.Code != http.StatusFound {
+				t.Fatalf("got status %d, want %d", w.Code, http.StatusFound)
+			}
+			if location := w.Header().Get("Location"); location != tt.location {
+				t.Errorf("got location %q, want %q", location, tt.location)
+			}
+		})
+	}
+}
+
+func TestChallenges(t *testing.T) {
+	basic := BasicAuth(User{Name: "admin", Password: "secret", Role: RoleAdmin})
+	bearer := BearerTokens(map[string]Principal{"token": {Name: "token", Role: RoleAdmin}})
+	for _, tt := range []struct {
+		name         string
+		authenticate Authenticator
+		challenges   []string
+	}{
+		{name: "basic", authenticate: basic, challenges: []string{`Basic realm="q"`}},
+		{name: "bearer", authenticate: bearer, challenges: []string{`Bearer realm="q"`}},
+		{name: "any of", authenticate: AnyOf(basic, bearer), challenges: []string{`Basic realm="q"`, `Bearer realm="q"`}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mux, _ := newTestMux(t, WithAuth(tt.authenticate))
+			for _, target := range []string{"/", "/api/v1/stats"} {
+				w := httptest.NewRecorder()
+				mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, target, nil))
+				if w.Code != http.StatusUnauthorized {
+					t.Errorf("%s: got status %d, want %d", target, w.Code, http.StatusUnauthorized)
+				}
+				if challenges := w.Header().Values("WWW-Authenticate"); !slices.Equal(challenges, tt.challenges) {
+					t.Errorf("%s: got challenges %q, want %q", target, challenges, tt.challenges)
+				}
+			}
+		})
+	}
+}
+
+func TestAPIVersion(t *testing.T) {
+	for _, tt := range []struct {
+		target string
+		code   int
+	}{
+		{target: "/api/v1/stats", code: http.StatusOK},
+		{target: "/api/stats", code: http.StatusOK},
+		{target: "/api/v1stats", code: http.StatusNotFound},
+		{target: "/api/v2/stats", code: http.StatusNotFound},
+	} {
+		t.Run(tt.target, func(t *testing.T) {
+			mux, _ := newTestMux(t)
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tt.target, nil))
+			if w.Code != tt.code {
+				t.Errorf("got status %d, want %d", w.Code, tt.code)
+			}
+		})
+	}
+}
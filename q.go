@@ -3,29 +3,183 @@ package q
 import (
 	"context"
 	"encoding/json"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type Q interface {
 	Receive(ctx context.Context, queue string, handler Handler) error
-	Send(ctx context.Context, queue, payload string) error
+	ReceiveBatch(ctx context.Context, queue string, size int, wait time.Duration, handler BatchHandler) error
+	Send(ctx context.Context, queue, payload string, options ...SendOption) (string, error)
+	SendBatch(ctx context.Context, queue string, payloads []string, options ...SendOption) error
 	Retry(ctx context.Context, id int64) error
-	Stats(ctx context.Context) (Stats, error)
+	Stats(ctx context.Context, queues ...string) (Stats, error)
+	ListFailed(ctx context.Context, filter FailedFilter, cursor, limit int64) ([]Failed, int64, error)
+	RetryAll(ctx context.Context, filter FailedFilter) (int64, error)
+	DeleteFailed(ctx context.Context, filter FailedFilter) (int64, error)
+	Purge(ctx context.Context, queue string) error
+	DeleteQueue(ctx context.Context, queue string) error
+	Pause(ctx context.Context, queue string) error
+	Resume(ctx context.Context, queue string) error
+	SetRateLimit(ctx context.Context, queue string, limit RateLimit) error
+	SetConcurrency(ctx context.Context, queue string, limit int64) error
+	ListPending(ctx context.Context, queue string, cursor, limit int64) ([]Message, int64, error)
+	DeletePending(ctx context.Context, queue, id string) error
+	MovePending(ctx context.Context, queue, id, to string) error
+	Events(ctx context.Context) (<-chan Event, error)
+	Worker(ctx context.Context, name string) (Worker, error)
+	History(ctx context.Context, queue string, window time.Duration) ([]Point, error)
+	Locks(ctx context.Context, cursor, limit int64) ([]Lock, int64, error)
 }
 
 type Handler func(ctx context.Context, payload string) error
 
+// BatchHandler handles a batch of messages. It returns a BatchError to report
+// the messages that failed; any other error fails the whole batch.
+type BatchHandler func(ctx context.Context, messages []Message) error
+
+// BatchError holds the errors of the messages of a batch that failed, by
+// index in the batch. The other messages succeeded.
+type BatchError map[int]error
+
+func (err BatchError) Error() string {
+	return strconv.Itoa(len(err)) + " messages of the batch failed"
+}
+
+// Tracer traces messages from Send to Receive. Send injects the span context
+// of the message into its headers, from which Receive extracts it.
+type Tracer interface {
+	// Start starts the span name for message, as a child of the span in ctx.
+	// The returned function ends the span, with the error of the operation.
+	Start(ctx context.Context, name string, message Message) (context.Context, func(error))
+	Inject(ctx context.Context, message *Message)
+	Extract(ctx context.Context, message Message) context.Context
+}
+
+// Names of the spans started by Tracer.
+const (
+	SpanEnqueue = "enqueue"
+	SpanDequeue = "dequeue"
+	SpanHandle  = "handle"
+	SpanRetry   = "retry"
+	SpanFail    = "fail"
+)
+
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, name string, message Message) (context.Context, func(error)) {
+	return ctx, func(error) {}
+}
+func (nopTracer) Inject(ctx context.Context, message *Message)                 {}
+func (nopTracer) Extract(ctx context.Context, message Message) context.Context { return ctx }
+
+// Logger logs the events of Q, with alternating keys and values as args.
+// *slog.Logger implements Logger.
+type Logger interface {
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+}
+
+// Observer is notified of the messages handled by Receive, with the duration
+// of the handler and the error it returned.
+type Observer interface {
+	Handled(queue string, message Message, duration time.Duration, err error)
+}
+
+// Stats holds the state of the queues and the workers. The time.Duration
+// fields of Stats are encoded in JSON as integer nanoseconds.
 type Stats struct {
-	Failed []Message
-	Queues map[string]int64
-	Stats  struct {
-		Processed int64
-		Failed    int64
+	Queues map[string]int64 `json:"queues"`
+	Paused map[string]bool  `json:"paused"`
+	// RateLimits holds the rate limits set with SetRateLimit, by queue.
+	RateLimits map[string]RateLimit `json:"rate_limits"`
+	// Concurrency holds the concurrency limits set with SetConcurrency, by
+	// queue.
+	Concurrency map[string]int64 `json:"concurrency"`
+	Stats       struct {
+		Processed int64 `json:"processed"`
+		Failed    int64 `json:"failed"`
+		Retried   int64 `json:"retried"`
+		Expired   int64 `json:"expired"`
+	} `json:"stats"`
+	QueueStats map[string]QueueStats `json:"queue_stats"`
+	Workers    map[string]Worker     `json:"workers"`
+}
+
+type QueueStats struct {
+	Processed  int64 `json:"processed"`
+	Failed     int64 `json:"failed"`
+	Retried    int64 `json:"retried"`
+	Expired    int64 `json:"expired"`
+	LastMinute Rate  `json:"last_minute"`
+	LastHour   Rate  `json:"last_hour"`
+	LastDay    Rate  `json:"last_day"`
+
+	// OldestAge is the age of the oldest message waiting in the queue.
+	OldestAge time.Duration `json:"oldest_age"`
+	// WaitTime is the time the messages of the last hour waited in the queue
+	// before being received, and RunTime the time their handler ran. They
+	// are rounded up to the buckets of histograms, by at most 19%.
+	WaitTime Percentiles `json:"wait_time"`
+	RunTime  Percentiles `json:"run_time"`
+
+	// Leases is the number of workers holding a lease on the queue, when it
+	// has a concurrency limit: those handling a message, or about to receive
+	// one.
+	Leases int64 `json:"leases"`
+}
+
+// RateLimit limits the messages received from a queue to Limit per Interval.
+// Up to Limit messages can be received at once after the queue was idle.
+type RateLimit struct {
+	Limit    int64         `json:"limit"`
+	Interval time.Duration `json:"interval"`
+}
+
+// Point holds the counters of a queue over Step, starting at Time.
+type Point struct {
+	Time      time.Time     `json:"time"`
+	Step      time.Duration `json:"step"`
+	Enqueued  int64         `json:"enqueued"`
+	Processed int64         `json:"processed"`
+	Failed    int64         `json:"failed"`
+	// Depth is the last length of the queue recorded during the step.
+	Depth int64 `json:"depth"`
+}
+
+type Percentiles struct {
+	P50 time.Duration `json:"p50"`
+	P90 time.Duration `json:"p90"`
+	P99 time.Duration `json:"p99"`
+	Max time.Duration `json:"max"`
+}
+
+// Rate holds the number of messages processed and failed over a window of
+// time.
+type Rate struct {
+	Window    time.Duration `json:"window"`
+	Processed int64         `json:"processed"`
+	Failed    int64         `json:"failed"`
+}
+
+// Throughput returns the number of messages processed per second.
+func (rate Rate) Throughput() float64 {
+	return float64(rate.Processed) / rate.Window.Seconds()
+}
+
+// FailureRate returns the fraction of processed messages that failed.
+func (rate Rate) FailureRate() float64 {
+	if rate.Processed == 0 {
+		return 0
 	}
-	Workers map[string]Worker
+	return float64(rate.Failed) / float64(rate.Processed)
 }
 
 type Message struct {
+	ID        string     `json:"id,omitempty"`
 	Payload   string     `json:"payload"`
 	Queue     string     `json:"queue,omitempty"`
 	CreatedAt time.Time  `json:"created_at"`
@@ -33,12 +187,106 @@ type Message struct {
 	FailedAt  *time.Time `json:"failed_at,omitempty"`
 	RetriedAt *time.Time `json:"retried_at,omitempty"`
 	Error     string     `json:"error,omitempty"`
+	// UniqueKey is the key set with the Unique option.
+	UniqueKey string `json:"unique_key,omitempty"`
+	// ExpiresAt is the time set with the ExpiresAt option.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+
+	// Headers carry metadata along with the message, like the span context
+	// injected by Tracer.
+	Headers map[string]string `json:"headers,omitempty"`
+}
+
+// expired returns whether message expired.
+func (message Message) expired() bool {
+	return message.ExpiresAt != nil && !time.Now().Before(*message.ExpiresAt)
 }
 
 func (message Message) MarshalBinary() ([]byte, error)     { return json.Marshal(message) }
 func (message *Message) UnmarshalBinary(data []byte) error { return json.Unmarshal(data, message) }
 
+// Failed is a message of the failed list. FailedID identifies the message in
+// the list, as expected by Retry; ids increase in the order messages failed,
+// and are kept when a message is retried.
+type Failed struct {
+	FailedID int64 `json:"failed_id"`
+	Message
+}
+
+// FailedFilter selects failed messages. Zero fields match all messages.
+type FailedFilter struct {
+	Queue   string
+	Error   string // substring of the error
+	Since   time.Time
+	Until   time.Time
+	Retried *bool
+}
+
+func (filter FailedFilter) match(message Message) bool {
+	if filter.Queue != "" && message.Queue != filter.Queue {
+		return false
+	}
+	if filter.Error != "" && !strings.Contains(message.Error, filter.Error) {
+		return false
+	}
+	if !filter.Since.IsZero() && (message.FailedAt == nil || message.FailedAt.Before(filter.Since)) {
+		return false
+	}
+	if !filter.Until.IsZero() && (message.FailedAt == nil || !message.FailedAt.Before(filter.Until)) {
+		return false
+	}
+	if filter.Retried != nil && *filter.Retried != (message.RetriedAt != nil) {
+		return false
+	}
+	return true
+}
+
+// Lock is a unique key held by a pending or running message. ExpiresAt is
+// zero for locks without expiry.
+type Lock struct {
+	Key       string    `json:"key"`
+	MessageID string    `json:"message_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Event is published by workers. Message is set for EventMessageFailed.
+type Event struct {
+	Type    string   `json:"type"`
+	Queue   string   `json:"queue"`
+	Worker  string   `json:"worker"`
+	Message *Message `json:"message,omitempty"`
+}
+
+// Types of Event.
+const (
+	EventWorkerStarted = "worker_started"
+	EventWorkerStopped = "worker_stopped"
+	EventMessageFailed = "message_failed"
+)
+
+func (event Event) MarshalBinary() ([]byte, error)     { return json.Marshal(event) }
+func (event *Event) UnmarshalBinary(data []byte) error { return json.Unmarshal(data, event) }
+
 type Worker struct {
-	Processed int64
-	Failed    int64
+	Host      string    `json:"host"`
+	PID       int       `json:"pid"`
+	Queue     string    `json:"queue"`
+	StartedAt time.Time `json:"started_at"`
+	// Heartbeat is the last time the worker was seen alive.
+	Heartbeat time.Time `json:"heartbeat"`
+	Processed int64     `json:"processed"`
+	Failed    int64     `json:"failed"`
+
+	// Message is the message being handled by the worker, with RunAt set to
+	// the time the worker received it, by the clock of Redis.
+	Message *Message `json:"message,omitempty"`
+}
+
+// Elapsed returns the time since the worker started handling its message, or
+// 0 when it is idle.
+func (worker Worker) Elapsed() time.Duration {
+	if worker.Message == nil || worker.Message.RunAt == nil {
+		return 0
+	}
+	return time.Since(*worker.Message.RunAt)
 }
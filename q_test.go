@@ -0,0 +1,45 @@
+package q
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailedFilterMatch(t *testing.T) {
+	failedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	retriedAt := failedAt.Add(time.Hour)
+	message := Message{Queue: "a", Error: "connection refused", FailedAt: &failedAt}
+	retried := message
+	retried.RetriedAt = &retriedAt
+	yes, no := true, false
+
+	for _, tt := range []struct {
+		name    string
+		filter  FailedFilter
+		message Message
+		match   bool
+	}{
+		{name: "empty", message: message, match: true},
+		{name: "queue", filter: FailedFilter{Queue: "a"}, message: message, match: true},
+		{name: "other queue", filter: FailedFilter{Queue: "b"}, message: message},
+		{name: "error", filter: FailedFilter{Error: "refused"}, message: message, match: true},
+		{name: "other error", filter: FailedFilter{Error: "timeout"}, message: message},
+		{name: "since", filter: FailedFilter{Since: failedAt}, message: message, match: true},
+		{name: "since later", filter: FailedFilter{Since: failedAt.Add(time.Second)}, message: message},
+		{name: "until later", filter: FailedFilter{Until: failedAt.Add(time.Second)}, message: message, match: true},
+		{name: "until", filter: FailedFilter{Until: failedAt}, message: message},
+		{name: "since without failed_at", filter: FailedFilter{Since: failedAt}, message: Message{Queue: "a"}},
+		{name: "until without failed_at", filter: FailedFilter{Until: failedAt}, message: Message{Queue: "a"}},
+		{name: "retried", filter: FailedFilter{Retried: &yes}, message: retried, match: true},
+		{name: "retried not", filter: FailedFilter{Retried: &yes}, message: message},
+		{name: "not retried", filter: FailedFilter{Retried: &no}, message: message, match: true},
+		{name: "not retried but", filter: FailedFilter{Retried: &no}, message: retried},
+		{name: "all", filter: FailedFilter{Queue: "a", Error: "refused", Since: failedAt, Until: retriedAt, Retried: &no}, message: message, match: true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if match := tt.filter.match(tt.message); match != tt.match {
+				t.Errorf("got %v, want %v", match, tt.match)
+			}
+		})
+	}
+}
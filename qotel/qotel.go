@@ -0,0 +1,92 @@
+// Package qotel implements q.Tracer with OpenTelemetry.
+package qotel
+
+import (
+	"context"
+
+	"github.com/yansal/q"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentationName = "github.com/yansal/q/qotel"
+
+// Option configures the Tracer returned by New.
+type Option func(*Tracer)
+
+// WithTracerProvider sets the tracer provider. It defaults to the global
+// tracer provider.
+func WithTracerProvider(provider trace.TracerProvider) Option {
+	return func(t *Tracer) { t.tracer = provider.Tracer(instrumentationName) }
+}
+
+// WithPropagator sets the propagator of the span contexts. It defaults to the
+// global text map propagator.
+func WithPropagator(propagator propagation.TextMapPropagator) Option {
+	return func(t *Tracer) { t.propagator = propagator }
+}
+
+// New returns a q.Tracer.
+func New(options ...Option) *Tracer {
+	t := &Tracer{
+		tracer:     otel.GetTracerProvider().Tracer(instrumentationName),
+		propagator: otel.GetTextMapPropagator(),
+	}
+	for _, option := range options {
+		option(t)
+	}
+	return t
+}
+
+// Tracer implements q.Tracer.
+type Tracer struct {
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+var kinds = map[string]trace.SpanKind{
+	q.SpanEnqueue: trace.SpanKindProducer,
+	q.SpanDequeue: trace.SpanKindConsumer,
+	q.SpanHandle:  trace.SpanKindInternal,
+	q.SpanRetry:   trace.SpanKindProducer,
+	q.SpanFail:    trace.SpanKindInternal,
+}
+
+// Start implements q.Tracer.
+func (t *Tracer) Start(ctx context.Context, name string, message q.Message) (context.Context, func(error)) {
+	ctx, span := t.tracer.Start(ctx, message.Queue+" "+name,
+		trace.WithSpanKind(kinds[name]),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "q"),
+			attribute.String("messaging.operation.name", name),
+			attribute.String("messaging.destination.name", message.Queue),
+			attribute.String("messaging.message.id", message.ID),
+		),
+	)
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
+
+// Inject implements q.Tracer.
+func (t *Tracer) Inject(ctx context.Context, message *q.Message) {
+	if message.Headers == nil {
+		message.Headers = make(map[string]string)
+	}
+	t.propagator.Inject(ctx, propagation.MapCarrier(message.Headers))
+	if len(message.Headers) == 0 {
+		message.Headers = nil
+	}
+}
+
+// Extract implements q.Tracer.
+func (t *Tracer) Extract(ctx context.Context, message q.Message) context.Context {
+	return t.propagator.Extract(ctx, propagation.MapCarrier(message.Headers))
+}
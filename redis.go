@@ -2,10 +2,14 @@ package q
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/go-redis/redis"
@@ -14,8 +18,15 @@ import (
 
 const (
 	// TODO: allow to configure the "q" namespace?
-	qFailed     = "q:failed"
+	qEvents   = "q:events"
+	qFailed   = "q:failures"
+	qFailedID = "q:failures:id"
+	// qFailedList is the list of failed messages of the previous versions,
+	// migrated to qFailed by migrateFailed.
+	qFailedList = "q:failed"
+	qPaused     = "q:paused"
 	qProcessing = "q:processing"
+	qPurged     = "q:purged"
 	qQueue      = "q:queues"
 	qQueues     = "q:queues"
 	qStats      = "q:stats"
@@ -23,35 +34,107 @@ const (
 	qWorkers    = "q:workers"
 )
 
-func New(client *redis.Client) Q {
-	return &qredis{redis: client}
+// ErrNotFound is returned when a message or a worker is not found.
+var ErrNotFound = errors.New("not found")
+
+// pollInterval is the maximum time Receive waits for a message before checking
+// again whether its queue is paused.
+const pollInterval = time.Second
+
+// Option configures the Q returned by New.
+type Option func(*qredis)
+
+// WithLogger sets the logger. It defaults to slog.Default().
+func WithLogger(logger Logger) Option {
+	return func(q *qredis) { q.logger = logger }
+}
+
+// WithTracer sets the tracer of the messages sent and received.
+func WithTracer(tracer Tracer) Option {
+	return func(q *qredis) { q.tracer = tracer }
+}
+
+// WithObserver adds an observer notified of the messages handled by Receive.
+func WithObserver(observer Observer) Option {
+	return func(q *qredis) { q.observers = append(q.observers, observer) }
+}
+
+// WithFailExpired makes Receive push the expired messages to the failed list,
+// with the error "expired", rather than only discarding them.
+func WithFailExpired() Option {
+	return func(q *qredis) { q.failExpired = true }
+}
+
+// WithStatsCache caches the result of Stats of all queues for ttl. Concurrent
+// calls to Stats share the same reads. The maps of the cached Stats are shared too, and must
+// not be modified.
+func WithStatsCache(ttl time.Duration) Option {
+	return func(q *qredis) { q.statsCache = &statsCache{ttl: ttl} }
+}
+
+func New(client *redis.Client, options ...Option) Q {
+	q := &qredis{redis: client, logger: slog.Default(), tracer: nopTracer{}}
+	for _, option := range options {
+		option(q)
+	}
+	return q
 }
 
 type qredis struct {
-	redis *redis.Client
+	redis      *redis.Client
+	logger     Logger
+	tracer     Tracer
+	observers  []Observer
+	statsCache *statsCache
+	// failExpired is set by WithFailExpired.
+	failExpired bool
+	// unlimited holds the last time take found each queue without rate
+	// limit.
+	unlimited sync.Map
+	// unbounded holds the last time acquire found each queue without
+	// concurrency limit.
+	unbounded sync.Map
 }
 
 func (q *qredis) Receive(ctx context.Context, queue string, handler Handler) error {
+	return q.work(ctx, queue, func(self, processing string, message Message) error {
+		return q.process(ctx, queue, self, processing, handler, message)
+	})
+}
+
+// work registers a worker of queue, then calls receive with each message it
+// moves from queue to its processing list, until ctx is done.
+func (q *qredis) work(ctx context.Context, queue string, receive func(self, processing string, message Message) error) error {
 	hostname, err := os.Hostname()
 	if err != nil {
 		return errors.WithStack(err)
 	}
-	name := fmt.Sprintf("%s:%d:%s:%d", hostname, os.Getpid(), queue, time.Now().UnixNano())
+	pid := os.Getpid()
+	name := fmt.Sprintf("%s:%d:%s:%d", hostname, pid, queue, time.Now().UnixNano())
 	self := qWorker + ":" + name
 	processing := qProcessing + ":" + name
 
-	if _, err := q.redis.SAdd(qWorkers, self).Result(); err != nil {
-		return errors.WithStack(err)
+	if err := q.register(self, hostname, pid, queue); err != nil {
+		return err
+	}
+	if err := q.migrateFailed(); err != nil {
+		return err
 	}
+	q.logger.Info("worker started", "worker", name, "queue", queue)
+	q.publish(Event{Type: EventWorkerStarted, Queue: queue, Worker: self})
 	defer func() {
 		if _, err := q.redis.SRem(qWorkers, self).Result(); err != nil {
-			log.Printf("%+v", errors.WithStack(err))
+			q.logger.Error("worker cleanup failed", "worker", name, "queue", queue, "error", err)
 		}
 
 		if _, err := q.redis.Del(self).Result(); err != nil {
-			log.Printf("%+v", errors.WithStack(err))
+			q.logger.Error("worker cleanup failed", "worker", name, "queue", queue, "error", err)
 		}
+		release(q.redis, queue, self)
+		q.logger.Info("worker stopped", "worker", name, "queue", queue)
+		q.publish(Event{Type: EventWorkerStopped, Queue: queue, Worker: self})
 	}()
+	defer q.heartbeat(self, queue)()
 
 	type msg struct {
 		message Message
@@ -60,9 +143,46 @@ func (q *qredis) Receive(ctx context.Context, queue string, handler Handler) err
 	brpoplpush := make(chan msg)
 
 	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		paused, err := q.redis.SIsMember(qPaused, queue).Result()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if paused {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+		if ok, err := q.acquire(queue, self); err != nil {
+			return err
+		} else if !ok {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(acquireInterval):
+			}
+			continue
+		}
+		if wait, err := q.take(queue, 1); err != nil {
+			return err
+		} else if wait > 0 {
+			// Other workers may use the lease meanwhile.
+			release(q.redis, queue, self)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(min(wait, pollInterval)):
+			}
+			continue
+		}
+
 		go func() {
-			var message Message
-			err := q.redis.BRPopLPush(queue, processing, 0).Scan(&message)
+			message, err := q.pop(queue, self, processing)
 			brpoplpush <- msg{
 				message: message,
 				err:     err,
@@ -75,6 +195,10 @@ func (q *qredis) Receive(ctx context.Context, queue string, handler Handler) err
 			return nil
 		case msg := <-brpoplpush:
 			if err := msg.err; err == redis.Nil {
+				if _, err := q.take(queue, -1); err != nil {
+					return err
+				}
+				release(q.redis, queue, self)
 				continue
 			} else if err != nil {
 				return errors.WithStack(err)
@@ -82,40 +206,186 @@ func (q *qredis) Receive(ctx context.Context, queue string, handler Handler) err
 			message = msg.message
 		}
 
-		message.RunAt = newnow()
-		if err := handler(ctx, message.Payload); err != nil {
-			message.FailedAt = newnow()
-
-			if _, ok := err.(interface{ StackTrace() errors.StackTrace }); ok {
-				message.Error = fmt.Sprintf("%+v", err)
-			} else {
-				message.Error = err.Error()
-			}
+		if err := receive(self, processing, message); err != nil {
+			return err
+		}
+	}
+}
 
-			if err := errors.WithStack(
-				q.redis.LPush(qFailed, message).Err()); err != nil {
-				return err
-			}
+// process runs handler with message and records the result.
+func (q *qredis) process(ctx context.Context, queue, self, processing string, handler Handler, message Message) (err error) {
+	ctx = q.tracer.Extract(ctx, message)
+	ctx, end := q.tracer.Start(ctx, SpanDequeue, message)
+	defer func() { end(err) }()
 
-			if err := q.redis.HIncrBy(qStats, "failed", 1).Err(); err != nil {
-				return errors.WithStack(err)
-			}
-			if err := q.redis.HIncrBy(self, "failed", 1).Err(); err != nil {
-				return errors.WithStack(err)
-			}
+	q.logger.Debug("message received", "queue", queue, "message_id", message.ID)
+	if message.expired() {
+		if err := q.complete(ctx, queue, self, processing, nil, nil, []Message{message}); err != nil {
+			return err
 		}
+		q.logger.Info("message expired", "queue", queue, "message_id", message.ID, "expires_at", *message.ExpiresAt)
+		return nil
+	}
+	message.RunAt = newnow()
+	handlerCtx, endHandle := q.tracer.Start(ctx, SpanHandle, message)
+	handlerErr := handler(handlerCtx, message.Payload)
+	endHandle(handlerErr)
+	duration := time.Since(*message.RunAt)
+
+	var failed *Message
+	if handlerErr != nil {
+		failed = failedMessage(message, handlerErr)
+	}
+	if err := q.complete(ctx, queue, self, processing, []Message{message}, []*Message{failed}, nil); err != nil {
+		return err
+	}
+	if failed != nil {
+		q.publish(Event{Type: EventMessageFailed, Queue: queue, Worker: self, Message: failed})
+	}
+
+	if handlerErr != nil {
+		q.logger.Warn("message failed", "queue", queue, "message_id", message.ID, "duration", duration, "error", handlerErr)
+	} else {
+		q.logger.Info("message succeeded", "queue", queue, "message_id", message.ID, "duration", duration)
+	}
+	for _, observer := range q.observers {
+		observer.Handled(queue, message, duration, handlerErr)
+	}
+	return nil
+}
+
+// failedMessage returns message failed with err.
+func failedMessage(message Message, err error) *Message {
+	message.FailedAt = newnow()
+	// The stack trace of errExpired would only point to its declaration.
+	if _, ok := err.(interface{ StackTrace() errors.StackTrace }); ok && err != errExpired {
+		message.Error = fmt.Sprintf("%+v", err)
+	} else {
+		message.Error = err.Error()
+	}
+	return &message
+}
 
-		if _, err := q.redis.Del(processing).Result(); err != nil {
+// complete records that the worker self handled messages and discarded the
+// expired ones, in a single transaction: messages are removed from the
+// processing list, the counters are incremented and, for each message whose
+// handler failed, failed[i] is pushed to the failed list. Expired messages are
+// pushed to the failed list too with WithFailExpired. The lease of self on
+// queue is released.
+func (q *qredis) complete(ctx context.Context, queue, self, processing string, messages []Message, failed []*Message, expired []Message) (err error) {
+	var nfailed int64
+	for i := range failed {
+		if failed[i] != nil {
+			nfailed++
+			_, end := q.tracer.Start(ctx, SpanFail, *failed[i])
+			defer func() { end(err) }()
+		}
+	}
+	npushed := nfailed
+	if q.failExpired {
+		npushed += int64(len(expired))
+	}
+	var id int64
+	if npushed > 0 {
+		last, err := q.redis.IncrBy(qFailedID, npushed).Result()
+		if err != nil {
 			return errors.WithStack(err)
 		}
+		id = last - npushed
+	}
 
-		if err := q.redis.HIncrBy(self, "processed", 1).Err(); err != nil {
-			return errors.WithStack(err)
+	var recorded func(redis.Cmdable, error) error
+	_, err = q.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		for i := range messages {
+			if failed[i] != nil {
+				id++
+				pushFailed(pipe, id, failed[i])
+			}
+			unlock(pipe, messages[i])
+			count(pipe, queue, failed[i] != nil)
+			sample(pipe, queue, messages[i], time.Now())
 		}
-		if err := q.redis.HIncrBy(qStats, "processed", 1).Err(); err != nil {
-			return errors.WithStack(err)
+		if nfailed > 0 {
+			pipe.HIncrBy(qStats, "failed", nfailed)
+			pipe.HIncrBy(self, "failed", nfailed)
 		}
+		for i := range expired {
+			if q.failExpired {
+				id++
+				pushFailed(pipe, id, failedMessage(expired[i], errExpired))
+			}
+			unlock(pipe, expired[i])
+		}
+		if len(expired) > 0 {
+			pipe.HIncrBy(qStats, "expired", int64(len(expired)))
+			pipe.HIncrBy(qStatsQueue+":"+queue, "expired", int64(len(expired)))
+		}
+		pipe.Del(processing)
+		pipe.HDel(self, "run_at")
+		release(pipe, queue, self)
+		pipe.HIncrBy(self, "processed", int64(len(messages)))
+		pipe.HIncrBy(qStats, "processed", int64(len(messages)))
+		recorded = depth(pipe, queue)
+		return nil
+	})
+	return errors.WithStack(recorded(q.redis, err))
+}
+
+// pushFailed adds message to the failed list with id, taken from the
+// qFailedID sequence.
+func pushFailed(pipe redis.Pipeliner, id int64, message *Message) {
+	pipe.ZAdd(qFailed, redis.Z{Score: float64(id), Member: message})
+}
+
+// publish publishes event. Events are informational, failing to publish them
+// is only logged.
+func (q *qredis) publish(event Event) {
+	if err := q.redis.Publish(qEvents, event).Err(); err != nil {
+		q.logger.Error("publishing event failed", "type", event.Type, "queue", event.Queue, "error", err)
+	}
+}
+
+// Events returns the events published by workers until ctx is done.
+func (q *qredis) Events(ctx context.Context) (<-chan Event, error) {
+	pubsub := q.redis.Subscribe(qEvents)
+	if _, err := pubsub.Receive(); err != nil {
+		pubsub.Close()
+		return nil, errors.WithStack(err)
 	}
+
+	events := make(chan Event)
+	go func() {
+		defer close(events)
+		defer pubsub.Close()
+		messages := pubsub.Channel()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case message, ok := <-messages:
+				if !ok {
+					return
+				}
+				var event Event
+				if err := event.UnmarshalBinary([]byte(message.Payload)); err != nil {
+					q.logger.Error("decoding event failed", "error", err)
+					continue
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return events, nil
+}
+
+// noScript returns whether err is the error of EVALSHA when Redis doesn't
+// have the script.
+func noScript(err error) bool {
+	return err != nil && strings.HasPrefix(err.Error(), "NOSCRIPT ")
 }
 
 func newnow() *time.Time {
@@ -123,86 +393,693 @@ func newnow() *time.Time {
 	return &now
 }
 
-func (q *qredis) Send(ctx context.Context, queue, payload string) error {
-	if _, err := q.redis.SAdd(qQueues, queue).Result(); err != nil {
-		return errors.WithStack(err)
+// SendOption configures a message sent by Send.
+type SendOption func(*sendOptions)
+
+type sendOptions struct {
+	uniqueKey string
+	uniqueTTL time.Duration
+	expiresAt time.Time
+}
+
+// ExpiresAt makes Receive discard the message if it is received after t.
+func ExpiresAt(t time.Time) SendOption {
+	return func(options *sendOptions) { options.expiresAt = t }
+}
+
+// errExpired is the error of the expired messages pushed to the failed list.
+var errExpired = errors.New("expired")
+
+// ErrUniqueBatch is returned by SendBatch with the Unique option, which only
+// applies to a single message.
+var ErrUniqueBatch = errors.New("unique messages can't be sent in batch")
+
+// Send sends payload to queue and returns the id of the message.
+func (q *qredis) Send(ctx context.Context, queue, payload string, options ...SendOption) (id string, err error) {
+	var o sendOptions
+	for _, option := range options {
+		option(&o)
 	}
-	return errors.WithStack(
-		q.redis.LPush(queue, Message{
-			Payload:   payload,
-			Queue:     queue,
-			CreatedAt: time.Now(),
-		}).Err())
+	message := newMessage(queue, payload)
+	message.UniqueKey = o.uniqueKey
+	if !o.expiresAt.IsZero() {
+		message.ExpiresAt = &o.expiresAt
+	}
+	ctx, end := q.tracer.Start(ctx, SpanEnqueue, message)
+	defer func() {
+		// Dropping a duplicate is not a failure of Send.
+		if err == ErrDuplicate {
+			end(nil)
+		} else {
+			end(err)
+		}
+	}()
+	q.tracer.Inject(ctx, &message)
+
+	if message.UniqueKey != "" {
+		if err := q.lock(message, o.uniqueTTL); err == ErrDuplicate {
+			q.logger.Debug("duplicate message dropped", "queue", queue, "unique_key", message.UniqueKey)
+			return "", err
+		} else if err != nil {
+			return "", err
+		}
+	}
+	var recorded func(redis.Cmdable, error) error
+	_, err = q.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd(qQueues, queue)
+		pipe.LPush(queue, message)
+		countEnqueued(pipe, queue, 1)
+		recorded = depth(pipe, queue)
+		return nil
+	})
+	if err = recorded(q.redis, err); err != nil {
+		unlock(q.redis, message)
+		return "", errors.WithStack(err)
+	}
+	return message.ID, nil
 }
 
-func (q *qredis) Retry(ctx context.Context, id int64) error {
-	// TODO: use a transaction
-	var msg Message
-	if err := q.redis.LIndex(qFailed, id).Scan(&msg); err != nil {
-		return errors.WithStack(err)
+// sendBatch is the maximum number of messages pushed by a single LPUSH in
+// SendBatch.
+const sendBatch = 1000
+
+// SendBatch sends payloads to queue in a single transaction: either all of
+// them are sent, or none is. The batch is traced as one enqueue span. Options
+// apply to all the messages; SendBatch returns ErrUniqueBatch with Unique.
+func (q *qredis) SendBatch(ctx context.Context, queue string, payloads []string, options ...SendOption) (err error) {
+	var o sendOptions
+	for _, option := range options {
+		option(&o)
 	}
-	msg.RetriedAt = newnow()
-	if err := q.redis.LSet(qFailed, id, msg).Err(); err != nil {
+	if o.uniqueKey != "" {
+		return ErrUniqueBatch
+	}
+	if len(payloads) == 0 {
+		return nil
+	}
+	ctx, end := q.tracer.Start(ctx, SpanEnqueue, Message{Queue: queue})
+	defer func() { end(err) }()
+
+	messages := make([]interface{}, len(payloads))
+	for i := range payloads {
+		message := newMessage(queue, payloads[i])
+		if !o.expiresAt.IsZero() {
+			message.ExpiresAt = &o.expiresAt
+		}
+		q.tracer.Inject(ctx, &message)
+		messages[i] = message
+	}
+
+	var recorded func(redis.Cmdable, error) error
+	_, err = q.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		pipe.SAdd(qQueues, queue)
+		for i := 0; i < len(messages); i += sendBatch {
+			pipe.LPush(queue, messages[i:min(i+sendBatch, len(messages))]...)
+		}
+		countEnqueued(pipe, queue, int64(len(messages)))
+		recorded = depth(pipe, queue)
+		return nil
+	})
+	return errors.WithStack(recorded(q.redis, err))
+}
+
+func newMessage(queue, payload string) Message {
+	return Message{
+		ID:        newID(),
+		Payload:   payload,
+		Queue:     queue,
+		CreatedAt: time.Now(),
+	}
+}
+
+func newID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// ListPending returns at most limit messages waiting in queue, starting at
+// cursor, from the newest to the oldest. limit is at most maxLimit, which a
+// limit <= 0 means too. The returned cursor is 0 when there are no more
+// messages.
+func (q *qredis) ListPending(ctx context.Context, queue string, cursor, limit int64) ([]Message, int64, error) {
+	limit = clampLimit(limit)
+	var messages []Message
+	if err := q.redis.LRange(queue, cursor, cursor+limit-1).ScanSlice(&messages); err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+	if int64(len(messages)) < limit {
+		return messages, 0, nil
+	}
+	return messages, cursor + limit, nil
+}
+
+// deletePendingScript removes ARGV[1] from the queue KEYS[1] and, if it was
+// there, releases the lock KEYS[2] on the unique key ARGV[3] if it is held by
+// the message ARGV[2].
+var deletePendingScript = redis.NewScript(`
+if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+if ARGV[3] ~= "" and redis.call("GET", KEYS[2]) == ARGV[2] then
+	redis.call("DEL", KEYS[2])
+	redis.call("ZREM", KEYS[3], ARGV[3])
+end
+return 1
+`)
+
+// DeletePending removes the message id waiting in queue, and releases its
+// unique lock.
+func (q *qredis) DeletePending(ctx context.Context, queue, id string) error {
+	raw, message, err := q.findPending(queue, id)
+	if err != nil {
+		return err
+	}
+	n, err := deletePendingScript.Run(q.redis, []string{queue, qUnique + ":" + message.UniqueKey, qUniques},
+		raw, message.ID, message.UniqueKey).Int64()
+	if err != nil {
 		return errors.WithStack(err)
 	}
-	return q.Send(ctx, msg.Queue, msg.Payload)
+	if n == 0 {
+		return errors.WithStack(ErrNotFound)
+	}
+	return nil
 }
 
-func (q *qredis) Stats(ctx context.Context) (Stats, error) {
-	var stats Stats
+// moveScript removes ARGV[1] from the queue KEYS[1], then sends ARGV[3] to
+// the queue ARGV[2].
+var moveScript = redis.NewScript(`
+if redis.call("LREM", KEYS[1], 1, ARGV[1]) == 0 then
+	return 0
+end
+redis.call("SADD", KEYS[2], ARGV[2])
+redis.call("LPUSH", KEYS[3], ARGV[3])
+return 1
+`)
 
-	members, err := q.redis.SMembers(qQueues).Result()
+// MovePending moves the message id waiting in queue to the queue to.
+func (q *qredis) MovePending(ctx context.Context, queue, id, to string) error {
+	raw, message, err := q.findPending(queue, id)
 	if err != nil {
-		return stats, errors.WithStack(err)
+		return err
 	}
-	stats.Queues = make(map[string]int64, len(members))
-	for i := range members {
-		llen, err := q.redis.LLen(members[i]).Result()
+	message.Queue = to
+	n, err := moveScript.Run(q.redis, []string{queue, qQueues, to}, raw, to, message).Int64()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n == 0 {
+		return errors.WithStack(ErrNotFound)
+	}
+	return nil
+}
+
+// findPending returns the raw value of the message id waiting in queue.
+func (q *qredis) findPending(queue, id string) (string, Message, error) {
+	for start := int64(0); ; start += scanBatch {
+		raws, err := q.redis.LRange(queue, start, start+scanBatch-1).Result()
 		if err != nil {
-			return stats, errors.WithStack(err)
+			return "", Message{}, errors.WithStack(err)
+		}
+		for i := range raws {
+			var message Message
+			if err := message.UnmarshalBinary([]byte(raws[i])); err != nil {
+				return "", Message{}, errors.WithStack(err)
+			}
+			if message.ID == id {
+				return raws[i], message, nil
+			}
+		}
+		if len(raws) < scanBatch {
+			return "", Message{}, errors.WithStack(ErrNotFound)
 		}
-		stats.Queues[members[i]] = llen
 	}
+}
 
-	processed, failed, err := q.stats(ctx, qStats)
-	if err != nil {
-		return stats, err
+// detachScript renames the queue KEYS[1] to KEYS[2], if it exists.
+var detachScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return 0
+end
+redis.call("RENAME", KEYS[1], KEYS[2])
+return 1
+`)
+
+// purgeScript removes at most ARGV[2] messages from the head of the list
+// KEYS[1] and releases the unique locks they hold. The lock on a unique key is
+// ARGV[1] followed by the key, which is indexed in KEYS[2]. It returns the
+// number of messages left.
+var purgeScript = redis.NewScript(`
+local messages = redis.call("LRANGE", KEYS[1], 0, tonumber(ARGV[2]) - 1)
+for i = 1, #messages do
+	if string.find(messages[i], '"unique_key"', 1, true) then
+		local message = cjson.decode(messages[i])
+		local lock = ARGV[1] .. message.unique_key
+		if redis.call("GET", lock) == message.id then
+			redis.call("DEL", lock)
+			redis.call("ZREM", KEYS[2], message.unique_key)
+		end
+	end
+end
+redis.call("LTRIM", KEYS[1], #messages, -1)
+return redis.call("LLEN", KEYS[1])
+`)
+
+// Purge removes all the messages of queue, and releases their unique locks.
+func (q *qredis) Purge(ctx context.Context, queue string) error {
+	purged := qPurged + ":" + queue + ":" + newID()
+	if err := detachScript.Run(q.redis, []string{queue, purged}).Err(); err != nil {
+		return errors.WithStack(err)
 	}
-	stats.Stats.Processed = processed
-	stats.Stats.Failed = failed
+	return q.purge(purged)
+}
+
+// purge releases the unique locks of the messages of the list purged, detached
+// from its queue, and removes it. The messages are removed scanBatch at a time,
+// so that Redis isn't blocked by long queues.
+func (q *qredis) purge(purged string) error {
+	for {
+		n, err := purgeScript.Run(q.redis, []string{purged, qUniques}, qUnique+":", scanBatch).Int64()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// DeleteQueue removes all the messages of queue, releasing their unique locks,
+// and forgets about it. The queue is created again by the next Send.
+func (q *qredis) DeleteQueue(ctx context.Context, queue string) error {
+	if err := detachScript.Load(q.redis).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	purged := qPurged + ":" + queue + ":" + newID()
+	if _, err := q.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		detachScript.EvalSha(pipe, []string{queue, purged})
+		pipe.Del(qStatsQueue+":"+queue, qRateLimit+":"+queue, qLeases+":"+queue)
+		pipe.SRem(qQueues, queue)
+		pipe.SRem(qPaused, queue)
+		pipe.HDel(qRateLimits, queue+":limit", queue+":interval")
+		pipe.HDel(qConcurrency, queue)
+		return nil
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+	return q.purge(purged)
+}
+
+// Pause stops workers from receiving messages from queue. Messages can still
+// be sent to a paused queue.
+func (q *qredis) Pause(ctx context.Context, queue string) error {
+	return errors.WithStack(q.redis.SAdd(qPaused, queue).Err())
+}
 
-	members, err = q.redis.SMembers(qWorkers).Result()
+// Resume lets workers receive messages from queue again.
+func (q *qredis) Resume(ctx context.Context, queue string) error {
+	return errors.WithStack(q.redis.SRem(qPaused, queue).Err())
+}
+
+// retryScript replaces the failed message ARGV[1] with ARGV[2], keeping its
+// id, sends ARGV[4] to the queue ARGV[3] and increments the retried counters.
+// It does nothing if ARGV[1] is not in the failed list anymore.
+var retryScript = redis.NewScript(`
+local id = redis.call("ZSCORE", KEYS[1], ARGV[1])
+if not id then
+	return 0
+end
+redis.call("ZREM", KEYS[1], ARGV[1])
+redis.call("ZADD", KEYS[1], id, ARGV[2])
+redis.call("SADD", KEYS[2], ARGV[3])
+redis.call("LPUSH", KEYS[3], ARGV[4])
+redis.call("HINCRBY", KEYS[4], "retried", 1)
+redis.call("HINCRBY", KEYS[5], "retried", 1)
+return 1
+`)
+
+// retry retries the failed message raw with c, in a span ended by the
+// returned function. It returns the message sent to the queue.
+func (q *qredis) retry(ctx context.Context, c redis.Cmdable, raw string, message Message) (*redis.Cmd, Message, func(error)) {
+	retried := message
+	retried.RetriedAt = newnow()
+
+	sent := newMessage(message.Queue, message.Payload)
+	ctx, end := q.tracer.Start(ctx, SpanRetry, sent)
+	q.tracer.Inject(ctx, &sent)
+
+	return retryScript.EvalSha(c,
+		[]string{qFailed, qQueues, message.Queue, qStats, qStatsQueue + ":" + message.Queue},
+		raw, retried, message.Queue, sent), sent, end
+}
+
+// Retry retries the failed message id.
+func (q *qredis) Retry(ctx context.Context, id int64) error {
+	if err := q.migrateFailed(); err != nil {
+		return err
+	}
+	score := strconv.FormatInt(id, 10)
+	raws, err := q.redis.ZRangeByScore(qFailed, redis.ZRangeBy{Min: score, Max: score}).Result()
 	if err != nil {
-		return stats, errors.WithStack(err)
+		return errors.WithStack(err)
+	}
+	if len(raws) == 0 {
+		return errors.WithStack(ErrNotFound)
+	}
+	raw := raws[0]
+	var message Message
+	if err := message.UnmarshalBinary([]byte(raw)); err != nil {
+		return errors.WithStack(err)
 	}
-	stats.Workers = make(map[string]Worker, len(members))
-	for i := range members {
-		processed, failed, err := q.stats(ctx, members[i])
+	if err := retryScript.Load(q.redis).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	cmd, sent, end := q.retry(ctx, q.redis, raw, message)
+	n, err := cmd.Int64()
+	end(err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if n == 0 {
+		return errors.WithStack(ErrNotFound)
+	}
+	q.logger.Info("message retried", "queue", message.Queue, "message_id", sent.ID, "failed_message_id", message.ID)
+	return nil
+}
+
+// RetryAll retries the failed messages matching filter, in batches. Each
+// message is retried atomically. Messages retried already are skipped, unless
+// filter.Retried is set.
+func (q *qredis) RetryAll(ctx context.Context, filter FailedFilter) (int64, error) {
+	if filter.Retried == nil {
+		retried := false
+		filter.Retried = &retried
+	}
+	if err := q.migrateFailed(); err != nil {
+		return 0, err
+	}
+	if err := retryScript.Load(q.redis).Err(); err != nil {
+		return 0, errors.WithStack(err)
+	}
+	var retried int64
+	err := q.scanFailed(filter, func(raws []string, messages []Message) error {
+		cmds := make([]*redis.Cmd, len(raws))
+		sent := make([]Message, len(raws))
+		ends := make([]func(error), len(raws))
+		_, err := q.redis.Pipelined(func(pipe redis.Pipeliner) error {
+			for i := range raws {
+				cmds[i], sent[i], ends[i] = q.retry(ctx, pipe, raws[i], messages[i])
+			}
+			return nil
+		})
+		for i := range cmds {
+			n, err := cmds[i].Int64()
+			ends[i](err)
+			if n == 1 {
+				q.logger.Info("message retried", "queue", messages[i].Queue, "message_id", sent[i].ID, "failed_message_id", messages[i].ID)
+			}
+			retried += n
+		}
+		return errors.WithStack(err)
+	})
+	return retried, err
+}
+
+// DeleteFailed deletes the failed messages matching filter, in batches.
+func (q *qredis) DeleteFailed(ctx context.Context, filter FailedFilter) (int64, error) {
+	if err := q.migrateFailed(); err != nil {
+		return 0, err
+	}
+	var deleted int64
+	err := q.scanFailed(filter, func(raws []string, messages []Message) error {
+		members := make([]interface{}, len(raws))
+		for i := range raws {
+			members[i] = raws[i]
+		}
+		n, err := q.redis.ZRem(qFailed, members...).Result()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		deleted += n
+		return nil
+	})
+	return deleted, err
+}
+
+// migrateScript moves up to ARGV[1] messages of the failed list KEYS[1] of the
+// previous versions, the oldest first, to the failed set KEYS[2], with ids
+// taken from the sequence KEYS[3]. It returns the number of messages left.
+var migrateScript = redis.NewScript(`
+for i = 1, tonumber(ARGV[1]) do
+	local raw = redis.call("RPOP", KEYS[1])
+	if not raw then
+		return 0
+	end
+	redis.call("ZADD", KEYS[2], redis.call("INCR", KEYS[3]), raw)
+end
+return redis.call("LLEN", KEYS[1])
+`)
+
+// migrateFailed moves the failed messages pushed to qFailedList, by previous
+// versions of workers, to qFailed. It moves scanBatch messages per call of the
+// script, so that large lists don't block Redis.
+func (q *qredis) migrateFailed() error {
+	for {
+		n, err := migrateScript.Run(q.redis, []string{qFailedList, qFailed, qFailedID}, scanBatch).Int64()
 		if err != nil {
+			return errors.WithStack(err)
+		}
+		if n == 0 {
+			return nil
+		}
+	}
+}
+
+// scanFailed calls fn with the batches of failed messages matching filter,
+// from the oldest to the newest, along with their raw values. Messages failing
+// after scanFailed is called are not scanned.
+func (q *qredis) scanFailed(filter FailedFilter, fn func(raws []string, messages []Message) error) error {
+	last, err := q.redis.Get(qFailedID).Result()
+	if err == redis.Nil {
+		return nil
+	} else if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The failed list is scanned by id, so that messages removed by fn
+	// don't shift the batches.
+	from := "-inf"
+	for {
+		zs, err := q.redis.ZRangeByScoreWithScores(qFailed, redis.ZRangeBy{Min: from, Max: last, Count: scanBatch}).Result()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if len(zs) == 0 {
+			return nil
+		}
+		from = "(" + strconv.FormatInt(int64(zs[len(zs)-1].Score), 10)
+
+		var (
+			matching []string
+			messages []Message
+		)
+		for i := range zs {
+			raw, _ := zs[i].Member.(string)
+			var message Message
+			if err := message.UnmarshalBinary([]byte(raw)); err != nil {
+				return errors.WithStack(err)
+			}
+			if filter.match(message) {
+				matching = append(matching, raw)
+				messages = append(messages, message)
+			}
+		}
+		if len(matching) == 0 {
+			continue
+		}
+		if err := fn(matching, messages); err != nil {
+			return err
+		}
+	}
+}
+
+// Stats returns the stats of queues, or of all queues if none is given.
+func (q *qredis) Stats(ctx context.Context, queues ...string) (Stats, error) {
+	if q.statsCache == nil || len(queues) > 0 {
+		return q.readStats(ctx, queues)
+	}
+	return q.statsCache.get(func() (Stats, error) { return q.readStats(ctx, nil) })
+}
+
+func (q *qredis) readStats(ctx context.Context, queues []string) (Stats, error) {
+	var stats Stats
+
+	var err error
+	if len(queues) == 0 {
+		if queues, err = q.scanSet(qQueues); err != nil {
 			return stats, err
 		}
-		stats.Workers[members[i]] = Worker{
-			Processed: processed,
-			Failed:    failed,
+	}
+	paused, err := q.scanSet(qPaused)
+	if err != nil {
+		return stats, err
+	}
+	workers, err := q.scanSet(qWorkers)
+	if err != nil {
+		return stats, err
+	}
+
+	var (
+		llens       = make([]*redis.IntCmd, len(queues))
+		totals      *redis.SliceCmd
+		rateLimits  *redis.StringStringMapCmd
+		concurrency *redis.StringStringMapCmd
+		queueStats  func(redis.Cmdable, error) (map[string]QueueStats, error)
+		workerStats func() (map[string]Worker, error)
+	)
+	_, err = q.redis.Pipelined(func(pipe redis.Pipeliner) error {
+		for i := range queues {
+			llens[i] = pipe.LLen(queues[i])
 		}
+		totals = pipe.HMGet(qStats, "processed", "failed", "retried", "expired")
+		rateLimits = pipe.HGetAll(qRateLimits)
+		concurrency = pipe.HGetAll(qConcurrency)
+		queueStats = pipeQueueStats(pipe, queues)
+		workerStats = pipeWorkers(pipe, workers)
+		return nil
+	})
+	if stats.QueueStats, err = queueStats(q.redis, err); err != nil {
+		return stats, err
 	}
 
-	if err := q.redis.LRange(qFailed, 0, 20).ScanSlice(&stats.Failed); err != nil {
-		return stats, errors.WithStack(err)
+	stats.Queues = make(map[string]int64, len(queues))
+	for i := range queues {
+		stats.Queues[queues[i]] = llens[i].Val()
+	}
+	stats.Paused = make(map[string]bool, len(paused))
+	for i := range paused {
+		stats.Paused[paused[i]] = true
+	}
+	stats.RateLimits = parseRateLimits(rateLimits.Val())
+	stats.Concurrency = parseConcurrency(concurrency.Val())
+	hmget := totals.Val()
+	for i, n := range []*int64{&stats.Stats.Processed, &stats.Stats.Failed, &stats.Stats.Retried, &stats.Stats.Expired} {
+		s, _ := hmget[i].(string)
+		*n, _ = strconv.ParseInt(s, 10, 64)
+	}
+	if stats.Workers, err = workerStats(); err != nil {
+		return stats, err
 	}
 	return stats, nil
 }
 
-func (q *qredis) stats(ctx context.Context, hash string) (int64, int64, error) {
-	hmget, err := q.redis.HMGet(hash, "processed", "failed").Result()
+type statsCache struct {
+	ttl time.Duration
+
+	mu    sync.Mutex
+	stats Stats
+	at    time.Time
+}
+
+// get returns the cached stats, or the stats returned by read if they are
+// older than the ttl of c.
+func (c *statsCache) get(read func() (Stats, error)) (Stats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.at.IsZero() && time.Since(c.at) < c.ttl {
+		return c.stats, nil
+	}
+	stats, err := read()
 	if err != nil {
-		return 0, 0, errors.WithStack(err)
+		return stats, err
+	}
+	c.stats, c.at = stats, time.Now()
+	return stats, nil
+}
+
+// scanCount is the number of members asked per SSCAN.
+const scanCount = 1000
+
+// scanSet returns the members of the set key. It uses SSCAN rather than
+// SMEMBERS, so that large sets don't block Redis.
+func (q *qredis) scanSet(key string) ([]string, error) {
+	seen := make(map[string]bool)
+	var members []string
+	var cursor uint64
+	for {
+		keys, next, err := q.redis.SScan(key, cursor, "", scanCount).Result()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		// SSCAN can return a member more than once.
+		for _, key := range keys {
+			if !seen[key] {
+				seen[key] = true
+				members = append(members, key)
+			}
+		}
+		if next == 0 {
+			return members, nil
+		}
+		cursor = next
+	}
+}
+
+// scanBatch is the number of messages fetched per round trip when scanning a
+// list.
+const scanBatch = 100
+
+// ListFailed returns at most limit failed messages matching filter, from the
+// newest to the oldest, starting after the id cursor, or at the newest message
+// if cursor is 0. limit is at most maxLimit, which a limit <= 0 means too. The
+// returned cursor is 0 when there are no more messages.
+func (q *qredis) ListFailed(ctx context.Context, filter FailedFilter, cursor, limit int64) ([]Failed, int64, error) {
+	if err := q.migrateFailed(); err != nil {
+		return nil, 0, err
 	}
+	limit = clampLimit(limit)
+	to := "+inf"
+	if cursor > 0 {
+		to = "(" + strconv.FormatInt(cursor, 10)
+	}
+	var failed []Failed
+	for {
+		zs, err := q.redis.ZRevRangeByScoreWithScores(qFailed, redis.ZRangeBy{Min: "-inf", Max: to, Count: scanBatch}).Result()
+		if err != nil {
+			return nil, 0, errors.WithStack(err)
+		}
+		for i := range zs {
+			id := int64(zs[i].Score)
+			to = "(" + strconv.FormatInt(id, 10)
+			raw, _ := zs[i].Member.(string)
+			var message Message
+			if err := message.UnmarshalBinary([]byte(raw)); err != nil {
+				return nil, 0, errors.WithStack(err)
+			}
+			if !filter.match(message) {
+				continue
+			}
+			failed = append(failed, Failed{FailedID: id, Message: message})
+			if int64(len(failed)) == limit {
+				return failed, id, nil
+			}
+		}
+		if len(zs) < scanBatch {
+			return failed, 0, nil
+		}
+	}
+}
 
-	processedStr, _ := hmget[0].(string)
-	processed, _ := strconv.ParseInt(processedStr, 10, 64)
+// maxLimit is the maximum number of messages returned by ListFailed and
+// ListPending, and of locks returned by Locks.
+const maxLimit = 1000
 
-	failedStr, _ := hmget[1].(string)
-	failed, _ := strconv.ParseInt(failedStr, 10, 64)
-	return processed, failed, nil
+// clampLimit returns limit, or maxLimit if limit is not in (0, maxLimit].
+func clampLimit(limit int64) int64 {
+	if limit <= 0 || limit > maxLimit {
+		return maxLimit
+	}
+	return limit
 }
@@ -0,0 +1,178 @@
+package q
+
+import (
+	"context"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// batchPollInterval is the interval between two polls of the queue while a
+// batch is collected.
+const batchPollInterval = 50 * time.Millisecond
+
+// ReceiveBatch receives messages from queue in batches of at most size
+// messages, and calls handler with each batch. A batch is handled as soon as it
+// is full, or wait after its first message was received.
+func (q *qredis) ReceiveBatch(ctx context.Context, queue string, size int, wait time.Duration, handler BatchHandler) error {
+	if size < 1 {
+		size = 1
+	}
+	return q.work(ctx, queue, func(self, processing string, message Message) error {
+		messages, err := q.collect(ctx, queue, processing, message, size, wait)
+		if err != nil || messages == nil {
+			return err
+		}
+		return q.processBatch(ctx, queue, self, processing, handler, messages)
+	})
+}
+
+// collect moves messages from queue to processing until there are size
+// messages, including first, or wait is elapsed. Each message takes a token
+// from the rate limit of queue. If ctx is done meanwhile, the messages are
+// moved back to queue and collect returns no messages.
+func (q *qredis) collect(ctx context.Context, queue, processing string, first Message, size int, wait time.Duration) ([]Message, error) {
+	messages := []Message{first}
+	deadline := time.Now().Add(wait)
+	for len(messages) < size {
+		poll := batchPollInterval
+		limited, err := q.take(queue, 1)
+		if err != nil {
+			return nil, err
+		}
+		if limited == 0 {
+			var message Message
+			err := q.redis.RPopLPush(queue, processing).Scan(&message)
+			if err == nil {
+				messages = append(messages, message)
+				continue
+			} else if err != redis.Nil {
+				return nil, errors.WithStack(err)
+			}
+			if _, err := q.take(queue, -1); err != nil {
+				return nil, err
+			}
+		} else {
+			poll = limited
+		}
+
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return nil, q.requeue(queue, processing, int64(len(messages)))
+		case <-time.After(min(remaining, poll)):
+		}
+	}
+	return messages, nil
+}
+
+// requeueScript moves the messages of the processing list KEYS[1] back to the
+// queue KEYS[2], where they are received first, in the order they were.
+var requeueScript = redis.NewScript(`
+local messages = redis.call("LRANGE", KEYS[1], 0, -1)
+for i = 1, #messages do
+	redis.call("RPUSH", KEYS[2], messages[i])
+end
+redis.call("DEL", KEYS[1])
+return #messages
+`)
+
+// requeue moves the n messages of processing back to queue, and puts back
+// their tokens in the rate limit of queue.
+func (q *qredis) requeue(queue, processing string, n int64) error {
+	if err := requeueScript.Run(q.redis, []string{processing, queue}).Err(); err != nil {
+		return errors.WithStack(err)
+	}
+	q.logger.Info("batch requeued", "queue", queue, "size", n)
+	_, err := q.take(queue, -n)
+	return err
+}
+
+// processBatch runs handler with messages and records the result of each
+// message.
+func (q *qredis) processBatch(ctx context.Context, queue, self, processing string, handler BatchHandler, messages []Message) (err error) {
+	ctx, end := q.tracer.Start(ctx, SpanDequeue, Message{Queue: queue})
+	defer func() { end(err) }()
+
+	// Each message is dequeued in a span of its own, child of the span it was
+	// sent in, and ended with the error of the message. The errors are indexed
+	// like messages: the messages of the previous versions have no ID.
+	errs := make([]error, len(messages))
+	for i := range messages {
+		_, endMessage := q.tracer.Start(q.tracer.Extract(ctx, messages[i]), SpanDequeue, messages[i])
+		defer func() {
+			if err != nil {
+				endMessage(err)
+			} else {
+				endMessage(errs[i])
+			}
+		}()
+	}
+
+	q.logger.Debug("batch received", "queue", queue, "size", len(messages))
+	var expired []Message
+	live := make([]Message, 0, len(messages))
+	index := make([]int, 0, len(messages)) // index in errs of the live messages
+	for i := range messages {
+		if messages[i].expired() {
+			expired = append(expired, messages[i])
+		} else {
+			live = append(live, messages[i])
+			index = append(index, i)
+		}
+	}
+	messages = live
+	if len(expired) > 0 {
+		q.logger.Info("messages expired", "queue", queue, "expired", len(expired))
+	}
+	if len(messages) == 0 {
+		return q.complete(ctx, queue, self, processing, nil, nil, expired)
+	}
+
+	runAt := newnow()
+	for i := range messages {
+		messages[i].RunAt = runAt
+	}
+	handlerCtx, endHandle := q.tracer.Start(ctx, SpanHandle, Message{Queue: queue})
+	handlerErr := handler(handlerCtx, messages)
+	endHandle(handlerErr)
+	duration := time.Since(*runAt)
+
+	failed := make([]*Message, len(messages))
+	nfailed := 0
+	for i := range messages {
+		err := handlerErr
+		if batchErr, ok := errors.Cause(handlerErr).(BatchError); ok {
+			err = batchErr[i]
+		}
+		if err != nil {
+			errs[index[i]] = err
+			failed[i] = failedMessage(messages[i], err)
+			nfailed++
+		}
+	}
+	if err := q.complete(ctx, queue, self, processing, messages, failed, expired); err != nil {
+		return err
+	}
+	for i := range failed {
+		if failed[i] != nil {
+			q.publish(Event{Type: EventMessageFailed, Queue: queue, Worker: self, Message: failed[i]})
+		}
+	}
+
+	if nfailed > 0 {
+		q.logger.Warn("batch failed", "queue", queue, "size", len(messages), "failed", nfailed, "duration", duration, "error", handlerErr)
+	} else {
+		q.logger.Info("batch succeeded", "queue", queue, "size", len(messages), "duration", duration)
+	}
+	for _, observer := range q.observers {
+		for i := range messages {
+			observer.Handled(queue, messages[i], duration, errs[index[i]])
+		}
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package q
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	qConcurrency = "q:concurrency"
+	qLeases      = "q:leases"
+)
+
+const (
+	// leaseTTL is the time after which the lease of a worker expires, unless
+	// its heartbeat renews it.
+	leaseTTL = 3 * heartbeatInterval
+
+	// acquireInterval is the interval between two attempts of a worker to
+	// acquire a lease.
+	acquireInterval = 100 * time.Millisecond
+)
+
+// ErrInvalidConcurrency is returned by SetConcurrency when the limit is
+// negative.
+var ErrInvalidConcurrency = errors.New("invalid concurrency limit")
+
+// SetConcurrency limits the number of messages of queue handled at once,
+// across all workers, to limit; a batch of ReceiveBatch counts as one. A zero
+// limit removes the concurrency limit of queue.
+func (q *qredis) SetConcurrency(ctx context.Context, queue string, limit int64) error {
+	if limit < 0 {
+		return ErrInvalidConcurrency
+	}
+	q.unbounded.Delete(queue)
+	if limit == 0 {
+		return errors.WithStack(q.redis.HDel(qConcurrency, queue).Err())
+	}
+	return errors.WithStack(q.redis.HSet(qConcurrency, queue, limit).Err())
+}
+
+// acquireScript gives the worker ARGV[2] a lease in KEYS[2] for ARGV[3]
+// milliseconds, if it holds one already or if less than the concurrency limit
+// of the queue ARGV[1] in KEYS[1] are held. Leases expire by the time of
+// Redis. It returns 1 if the worker holds a lease, 0 if it doesn't, or -1 if
+// the queue has no concurrency limit.
+var acquireScript = redis.NewScript(`
+redis.replicate_commands()
+local limit = tonumber(redis.call("HGET", KEYS[1], ARGV[1]))
+if not limit then
+	return -1
+end
+local time = redis.call("TIME")
+local now = time[1] * 1000 + math.floor(time[2] / 1000)
+redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", now)
+if not redis.call("ZSCORE", KEYS[2], ARGV[2]) and redis.call("ZCARD", KEYS[2]) >= limit then
+	return 0
+end
+redis.call("ZADD", KEYS[2], now + tonumber(ARGV[3]), ARGV[2])
+return 1
+`)
+
+// acquire returns whether the worker self holds a lease on queue, taking one
+// if needed. It always returns true if queue has no concurrency limit. A queue
+// found without concurrency limit is not checked again for unlimitedInterval.
+func (q *qredis) acquire(queue, self string) (bool, error) {
+	if at, ok := q.unbounded.Load(queue); ok && time.Since(at.(time.Time)) < unlimitedInterval {
+		return true, nil
+	}
+	n, err := acquireScript.Run(q.redis, []string{qConcurrency, qLeases + ":" + queue}, queue, self, int64(leaseTTL/time.Millisecond)).Int64()
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+	if n < 0 {
+		q.unbounded.Store(queue, time.Now())
+		return true, nil
+	}
+	q.unbounded.Delete(queue)
+	return n == 1, nil
+}
+
+// release releases the lease of the worker self on queue, if any.
+func release(c redis.Cmdable, queue, self string) {
+	c.ZRem(qLeases+":"+queue, self)
+}
+
+// renewScript extends the lease of the worker ARGV[1] in KEYS[1], if it holds
+// one, to ARGV[2] milliseconds from the time of Redis.
+var renewScript = redis.NewScript(`
+redis.replicate_commands()
+local time = redis.call("TIME")
+local expiry = time[1] * 1000 + math.floor(time[2] / 1000) + tonumber(ARGV[2])
+return redis.call("ZADD", KEYS[1], "XX", expiry, ARGV[1])
+`)
+
+// renew queues in pipe the extension of the lease of the worker self on queue,
+// if any. The returned function must be called once pipe is executed: if Redis
+// didn't have the script, it renews the lease with c and EVAL.
+func renew(pipe redis.Pipeliner, queue, self string) func(c redis.Cmdable) error {
+	keys := []string{qLeases + ":" + queue}
+	ttl := int64(leaseTTL / time.Millisecond)
+	cmd := renewScript.EvalSha(pipe, keys, self, ttl)
+	return func(c redis.Cmdable) error {
+		if !noScript(cmd.Err()) {
+			return nil
+		}
+		return renewScript.Eval(c, keys, self, ttl).Err()
+	}
+}
+
+// leasesScript returns the number of leases not expired at the time of Redis
+// in each of KEYS.
+var leasesScript = redis.NewScript(`
+local time = redis.call("TIME")
+local now = time[1] * 1000 + math.floor(time[2] / 1000)
+local counts = {}
+for i, key in ipairs(KEYS) do
+	counts[i] = redis.call("ZCOUNT", key, "(" .. now, "+inf")
+end
+return counts
+`)
+
+// parseConcurrency parses the concurrency limits of the hash qConcurrency.
+func parseConcurrency(fields map[string]string) map[string]int64 {
+	limits := make(map[string]int64, len(fields))
+	for queue, value := range fields {
+		if n, err := strconv.ParseInt(value, 10, 64); err == nil {
+			limits[queue] = n
+		}
+	}
+	return limits
+}
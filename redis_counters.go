@@ -0,0 +1,362 @@
+package q
+
+import (
+	"context"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// The counts of all queues are aggregated in the per-minute and per-hour
+// buckets qStatsMinute and qStatsHour, which hold the depth of each queue too.
+// The counts of each queue, with its latency histograms, are kept in buckets
+// of their own, prefixed with the queue, so that reading a queue doesn't read
+// the others.
+const (
+	qStatsQueue  = "q:stats:queue"
+	qStatsMinute = "q:stats:minute"
+	qStatsHour   = "q:stats:hour"
+
+	// Buckets are kept a bit longer than the longest window they are summed
+	// over.
+	minuteBucketTTL = 2 * time.Hour
+	hourBucketTTL   = 48 * time.Hour
+
+	// latencyResolution is the number of buckets of the latency histograms
+	// per doubling of the duration: percentiles are rounded up by at most
+	// 2^(1/latencyResolution), about 19%.
+	latencyResolution = 4
+)
+
+// count increments the processed counters of queue, and its failed counters
+// if failed is true. Besides the all-time counters, the counts are stored in
+// per-minute and per-hour buckets from which rates are computed.
+func count(pipe redis.Pipeliner, queue string, failed bool) {
+	fields := []string{"processed"}
+	if failed {
+		fields = append(fields, "failed")
+	}
+	for _, field := range fields {
+		pipe.HIncrBy(qStatsQueue+":"+queue, field, 1)
+	}
+	countBuckets(pipe, queue, 1, fields...)
+}
+
+// countEnqueued increments by n the enqueued counters of queue in the
+// per-minute and per-hour buckets.
+func countEnqueued(pipe redis.Pipeliner, queue string, n int64) {
+	countBuckets(pipe, queue, n, "enqueued")
+}
+
+// countBuckets increments by n the fields of the current buckets of queue and
+// of all queues.
+func countBuckets(pipe redis.Pipeliner, queue string, n int64, fields ...string) {
+	for _, bucket := range currentBuckets(queue) {
+		for _, field := range fields {
+			pipe.HIncrBy(bucket.key, field, n)
+		}
+		pipe.Expire(bucket.key, bucket.ttl)
+	}
+}
+
+type statsBucket struct {
+	key string
+	ttl time.Duration
+}
+
+// currentBuckets returns the current per-minute and per-hour buckets of all
+// queues, then of queue.
+func currentBuckets(queue string) []statsBucket {
+	now := time.Now()
+	return []statsBucket{
+		{key: bucketKey(qStatsMinute, now, time.Minute), ttl: minuteBucketTTL},
+		{key: bucketKey(qStatsHour, now, time.Hour), ttl: hourBucketTTL},
+		{key: bucketKey(qStatsMinute+":"+queue, now, time.Minute), ttl: minuteBucketTTL},
+		{key: bucketKey(qStatsHour+":"+queue, now, time.Hour), ttl: hourBucketTTL},
+	}
+}
+
+// depthScript sets the field ARGV[i-1] of the bucket KEYS[i], for i > 1, to
+// the length of the queue KEYS[1].
+var depthScript = redis.NewScript(`
+local n = redis.call("LLEN", KEYS[1])
+for i = 2, #KEYS do
+	redis.call("HSET", KEYS[i], ARGV[i - 1], n)
+end
+return n
+`)
+
+// depth records the current length of queue in the per-minute and per-hour
+// buckets, of all queues as the field <queue>:depth and of queue as the field
+// depth. The buckets must have been created, with their expiry, earlier in
+// pipe.
+//
+// The script is run with EVALSHA. The returned function must be called with
+// the error of pipe once executed: if Redis didn't have the script, which only
+// fails this command of the pipeline, it records the depth with c and EVAL,
+// which loads the script for the next times.
+func depth(pipe redis.Pipeliner, queue string) func(c redis.Cmdable, err error) error {
+	keys := []string{queue}
+	for _, bucket := range currentBuckets(queue) {
+		keys = append(keys, bucket.key)
+	}
+	fields := []interface{}{queue + ":depth", queue + ":depth", "depth", "depth"}
+	cmd := depthScript.EvalSha(pipe, keys, fields...)
+	return func(c redis.Cmdable, err error) error {
+		if err == nil || err != cmd.Err() || !noScript(err) {
+			return err
+		}
+		return depthScript.Eval(c, keys, fields...).Err()
+	}
+}
+
+// sample records the time message waited in queue, and the time its handler
+// ran until now, in the histograms of the per-minute bucket of queue of now.
+func sample(pipe redis.Pipeliner, queue string, message Message, now time.Time) {
+	if message.RunAt == nil {
+		return
+	}
+	wait := message.RunAt.Sub(message.CreatedAt)
+	run := now.Sub(*message.RunAt)
+	minute := bucketKey(qStatsMinute+":"+queue, now, time.Minute)
+	pipe.HIncrBy(minute, "wait:"+strconv.Itoa(latencyBucket(wait)), 1)
+	pipe.HIncrBy(minute, "run:"+strconv.Itoa(latencyBucket(run)), 1)
+	pipe.Expire(minute, minuteBucketTTL)
+}
+
+// latencyBucket returns the bucket of the latency histograms holding d. The
+// bucket i holds the durations up to latencyBound(i).
+func latencyBucket(d time.Duration) int {
+	if d <= time.Microsecond {
+		return 0
+	}
+	return int(math.Ceil(latencyResolution * math.Log2(float64(d)/float64(time.Microsecond))))
+}
+
+// latencyBound returns the upper bound of the bucket i of the latency
+// histograms.
+func latencyBound(i int) time.Duration {
+	return time.Duration(float64(time.Microsecond) * math.Exp2(float64(i)/latencyResolution))
+}
+
+func bucketKey(prefix string, t time.Time, d time.Duration) string {
+	return prefix + ":" + strconv.FormatInt(t.Truncate(d).Unix(), 10)
+}
+
+// pipeQueueStats queues in pipe the reads of the counters of queues. The
+// returned function returns the counters once pipe is executed. Rates are
+// computed over complete buckets: the last minute, the last 60 minutes and
+// the last 24 hours. Latency percentiles are computed over the last 60
+// minutes.
+//
+// Leases expire by the time of Redis, so they are counted by a script run with
+// EVALSHA. The returned function must be called with the error of pipe once
+// executed: if Redis didn't have the script, it counts the leases with c and
+// EVAL.
+func pipeQueueStats(pipe redis.Pipeliner, queues []string) func(c redis.Cmdable, err error) (map[string]QueueStats, error) {
+	now := time.Now()
+	totals := make([]*redis.SliceCmd, len(queues))
+	oldest := make([]*redis.StringSliceCmd, len(queues))
+	leaseKeys := make([]string, len(queues))
+	minutes := make([][]*redis.StringStringMapCmd, len(queues))
+	hours := make([][]*redis.StringStringMapCmd, len(queues))
+	for i := range queues {
+		totals[i] = pipe.HMGet(qStatsQueue+":"+queues[i], "processed", "failed", "retried", "expired")
+		oldest[i] = pipe.LRange(queues[i], -1, -1)
+		leaseKeys[i] = qLeases + ":" + queues[i]
+		minutes[i] = make([]*redis.StringStringMapCmd, 60)
+		for j := range minutes[i] {
+			minutes[i][j] = pipe.HGetAll(bucketKey(qStatsMinute+":"+queues[i], now.Add(-time.Duration(j+1)*time.Minute), time.Minute))
+		}
+		hours[i] = make([]*redis.StringStringMapCmd, 24)
+		for j := range hours[i] {
+			hours[i][j] = pipe.HGetAll(bucketKey(qStatsHour+":"+queues[i], now.Add(-time.Duration(j+1)*time.Hour), time.Hour))
+		}
+	}
+	leases := leasesScript.EvalSha(pipe, leaseKeys)
+
+	return func(c redis.Cmdable, err error) (map[string]QueueStats, error) {
+		if err != nil && (err != leases.Err() || !noScript(err)) {
+			return nil, errors.WithStack(err)
+		}
+		counts, err := leases.Result()
+		if noScript(err) {
+			counts, err = leasesScript.Eval(c, leaseKeys).Result()
+		}
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		stats := make(map[string]QueueStats, len(queues))
+		for i, queue := range queues {
+			lastMinute := sumBuckets(minutes[i][:1])
+			lastHour := sumBuckets(minutes[i])
+			lastDay := sumBuckets(hours[i])
+
+			hmget := totals[i].Val()
+			processedStr, _ := hmget[0].(string)
+			processed, _ := strconv.ParseInt(processedStr, 10, 64)
+			failedStr, _ := hmget[1].(string)
+			failed, _ := strconv.ParseInt(failedStr, 10, 64)
+			retriedStr, _ := hmget[2].(string)
+			retried, _ := strconv.ParseInt(retriedStr, 10, 64)
+			expiredStr, _ := hmget[3].(string)
+			expired, _ := strconv.ParseInt(expiredStr, 10, 64)
+
+			var oldestAge time.Duration
+			var messages []Message
+			if err := oldest[i].ScanSlice(&messages); err == nil && len(messages) == 1 {
+				oldestAge = now.Sub(messages[0].CreatedAt)
+			}
+
+			stats[queue] = QueueStats{
+				Processed:  processed,
+				Failed:     failed,
+				Retried:    retried,
+				Expired:    expired,
+				LastMinute: rate(lastMinute, time.Minute),
+				LastHour:   rate(lastHour, time.Hour),
+				LastDay:    rate(lastDay, 24*time.Hour),
+				OldestAge:  oldestAge,
+				WaitTime:   percentiles(lastHour, "wait:"),
+				RunTime:    percentiles(lastHour, "run:"),
+				Leases:     counts.([]interface{})[i].(int64),
+			}
+		}
+		return stats, nil
+	}
+}
+
+// sumBuckets sums the fields of buckets.
+func sumBuckets(buckets []*redis.StringStringMapCmd) map[string]int64 {
+	sums := make(map[string]int64)
+	for _, bucket := range buckets {
+		for field, value := range bucket.Val() {
+			n, _ := strconv.ParseInt(value, 10, 64)
+			sums[field] += n
+		}
+	}
+	return sums
+}
+
+func rate(sums map[string]int64, window time.Duration) Rate {
+	return Rate{
+		Window:    window,
+		Processed: sums["processed"],
+		Failed:    sums["failed"],
+	}
+}
+
+// percentiles returns the percentiles of the histogram whose buckets are the
+// fields of sums starting with prefix. They are the upper bounds of the
+// buckets holding them.
+func percentiles(sums map[string]int64, prefix string) Percentiles {
+	type bucket struct {
+		i int
+		n int64
+	}
+	var (
+		buckets []bucket
+		total   int64
+	)
+	for field, n := range sums {
+		suffix, ok := strings.CutPrefix(field, prefix)
+		if !ok || n <= 0 {
+			continue
+		}
+		i, err := strconv.Atoi(suffix)
+		if err != nil {
+			continue
+		}
+		buckets = append(buckets, bucket{i: i, n: n})
+		total += n
+	}
+	if total == 0 {
+		return Percentiles{}
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].i < buckets[j].i })
+	at := func(p float64) time.Duration {
+		rank := int64(p*float64(total-1)) + 1
+		for _, bucket := range buckets {
+			if rank <= bucket.n {
+				return latencyBound(bucket.i)
+			}
+			rank -= bucket.n
+		}
+		return latencyBound(buckets[len(buckets)-1].i)
+	}
+	return Percentiles{
+		P50: at(.5),
+		P90: at(.9),
+		P99: at(.99),
+		Max: latencyBound(buckets[len(buckets)-1].i),
+	}
+}
+
+// History returns the counters of queue, or of all queues if queue is empty,
+// over the last window. Points are a minute apart when window fits in the
+// per-minute buckets, and an hour apart otherwise. The last point is the
+// current, incomplete, bucket.
+func (q *qredis) History(ctx context.Context, queue string, window time.Duration) ([]Point, error) {
+	step, prefix := time.Minute, qStatsMinute
+	if window > minuteBucketTTL {
+		step, prefix = time.Hour, qStatsHour
+	}
+	if window > hourBucketTTL {
+		window = hourBucketTTL
+	}
+	n := int(window / step)
+	if n < 1 {
+		n = 1
+	}
+
+	// The buckets of all queues hold the depth of each queue as the field
+	// <queue>:depth, and the buckets of a queue its depth as the field depth.
+	if queue != "" {
+		prefix += ":" + queue
+	}
+	now := time.Now().Truncate(step)
+	buckets := make([]*redis.StringStringMapCmd, n)
+	if _, err := q.redis.Pipelined(func(pipe redis.Pipeliner) error {
+		for i := range buckets {
+			buckets[i] = pipe.HGetAll(bucketKey(prefix, now.Add(-time.Duration(n-1-i)*step), step))
+		}
+		return nil
+	}); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Depths are only recorded when messages are sent or processed, so
+	// buckets without depth keep the previous one.
+	depths := make(map[string]int64)
+	points := make([]Point, n)
+	for i := range buckets {
+		point := Point{Time: now.Add(-time.Duration(n-1-i) * step), Step: step}
+		for field, value := range buckets[i].Val() {
+			v, _ := strconv.ParseInt(value, 10, 64)
+			switch field {
+			case "enqueued":
+				point.Enqueued += v
+			case "processed":
+				point.Processed += v
+			case "failed":
+				point.Failed += v
+			case "depth":
+				depths[queue] = v
+			default:
+				if name, ok := strings.CutSuffix(field, ":depth"); ok {
+					depths[name] = v
+				}
+			}
+		}
+		for _, v := range depths {
+			point.Depth += v
+		}
+		points[i] = point
+	}
+	return points, nil
+}
@@ -0,0 +1,158 @@
+package q
+
+import (
+	"context"
+	"math"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/go-redis/redis"
+)
+
+func TestLatencyBucket(t *testing.T) {
+	for _, d := range []time.Duration{
+		0,
+		time.Microsecond,
+		time.Microsecond + 1,
+		2 * time.Microsecond,
+		3 * time.Millisecond,
+		time.Second,
+		time.Second + 1,
+		90 * time.Minute,
+	} {
+		i := latencyBucket(d)
+		if bound := latencyBound(i); bound < d {
+			t.Errorf("%v: bucket %d bound %v is below", d, i, bound)
+		} else if d > time.Microsecond && float64(bound) > float64(d)*math.Exp2(1.0/latencyResolution) {
+			t.Errorf("%v: bucket %d bound %v is too far above", d, i, bound)
+		}
+		if i > 0 && latencyBound(i-1) >= d {
+			t.Errorf("%v: previous bucket %d bound %v holds it", d, i-1, latencyBound(i-1))
+		}
+	}
+}
+
+func TestPercentiles(t *testing.T) {
+	sums := map[string]int64{
+		"wait:0":    1,
+		"wait:40":   98,
+		"wait:80":   1,
+		"wait:x":    5,
+		"wait:90":   0,
+		"run:100":   5,
+		"processed": 100,
+	}
+	want := Percentiles{
+		P50: latencyBound(40),
+		P90: latencyBound(40),
+		P99: latencyBound(40),
+		Max: latencyBound(80),
+	}
+	if got := percentiles(sums, "wait:"); got != want {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+	if got := percentiles(sums, "run:"); got.P50 != latencyBound(100) || got.Max != latencyBound(100) {
+		t.Errorf("got %+v, want all %v", got, latencyBound(100))
+	}
+	if got := percentiles(sums, "none:"); got != (Percentiles{}) {
+		t.Errorf("got %+v, want zero", got)
+	}
+}
+
+// BenchmarkStats reads the stats of 100 queues with 1000 messages processed
+// each, of all queues and of a single queue, and compares them with the
+// sequential reads of the lengths and counters that Stats used to do. It runs
+// against the Redis of REDIS_URL, and is skipped without it.
+func BenchmarkStats(b *testing.B) {
+	redisURL := os.Getenv("REDIS_URL")
+	if redisURL == "" {
+		b.Skip("REDIS_URL is not set")
+	}
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		b.Fatal(err)
+	}
+	client := redis.NewClient(opts)
+	b.Cleanup(func() { client.Close() })
+	q := New(client)
+	ctx := context.Background()
+
+	queues := make([]string, 100)
+	for i := range queues {
+		queues[i] = "bench:stats:" + strconv.Itoa(i)
+	}
+	b.Cleanup(func() {
+		for _, queue := range queues {
+			if err := q.DeleteQueue(ctx, queue); err != nil {
+				b.Error(err)
+			}
+		}
+	})
+	// Stats reads the complete minutes only.
+	now := time.Now().Add(-time.Minute)
+	for i, queue := range queues {
+		if _, err := client.Pipelined(func(pipe redis.Pipeliner) error {
+			pipe.SAdd(qQueues, queue)
+			for j := 0; j < 1000; j++ {
+				runAt := now.Add(-time.Duration(i*j) * time.Millisecond)
+				message := Message{CreatedAt: runAt.Add(-time.Duration(j) * time.Millisecond), RunAt: &runAt}
+				count(pipe, queue, j%10 == 0)
+				sample(pipe, queue, message, now)
+			}
+			return nil
+		}); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	b.Run("all", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := q.Stats(ctx); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("queue", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := q.Stats(ctx, queues[0]); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("sequential", func(b *testing.B) {
+		for b.Loop() {
+			if err := readStatsSequential(client); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// readStatsSequential reads the lengths of the queues and the counters of
+// the workers one command at a time, as Stats used to.
+func readStatsSequential(client *redis.Client) error {
+	queues, err := client.SMembers(qQueues).Result()
+	if err != nil {
+		return err
+	}
+	for _, queue := range queues {
+		if err := client.LLen(queue).Err(); err != nil {
+			return err
+		}
+	}
+	if err := client.HMGet(qStats, "processed", "failed").Err(); err != nil {
+		return err
+	}
+	workers, err := client.SMembers(qWorkers).Result()
+	if err != nil {
+		return err
+	}
+	for _, worker := range workers {
+		if err := client.HMGet(worker, "processed", "failed").Err(); err != nil {
+			return err
+		}
+	}
+	return client.LRange(qFailedList, 0, 20).Err()
+}
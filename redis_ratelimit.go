@@ -0,0 +1,121 @@
+package q
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	qRateLimits = "q:ratelimits"
+	qRateLimit  = "q:ratelimit"
+)
+
+// unlimitedInterval is the time during which take and acquire assume that a
+// queue found without rate or concurrency limit still has none.
+const unlimitedInterval = pollInterval
+
+// ErrInvalidRateLimit is returned by SetRateLimit when the limit is negative,
+// or the interval is shorter than a millisecond.
+var ErrInvalidRateLimit = errors.New("invalid rate limit")
+
+// SetRateLimit limits the messages received from queue, across all workers,
+// to limit.Limit per limit.Interval. A zero limit removes the rate limit of
+// queue.
+func (q *qredis) SetRateLimit(ctx context.Context, queue string, limit RateLimit) error {
+	if limit.Limit < 0 || (limit.Limit > 0 && limit.Interval < time.Millisecond) {
+		return ErrInvalidRateLimit
+	}
+	q.unlimited.Delete(queue)
+	_, err := q.redis.TxPipelined(func(pipe redis.Pipeliner) error {
+		if limit.Limit == 0 {
+			pipe.HDel(qRateLimits, queue+":limit", queue+":interval")
+		} else {
+			pipe.HMSet(qRateLimits, map[string]interface{}{
+				queue + ":limit":    limit.Limit,
+				queue + ":interval": int64(limit.Interval / time.Millisecond),
+			})
+		}
+		pipe.Del(qRateLimit + ":" + queue)
+		return nil
+	})
+	return errors.WithStack(err)
+}
+
+// takeScript takes ARGV[2] tokens from the bucket KEYS[2] of the queue
+// ARGV[1], whose limit and interval in milliseconds are in KEYS[1], at the time
+// of Redis. The bucket holds up to limit tokens and refills at limit tokens per
+// interval. A negative ARGV[2] puts tokens back. It returns 0 if the tokens
+// were taken, the milliseconds until they can be, or -1 if the queue has no
+// rate limit.
+var takeScript = redis.NewScript(`
+redis.replicate_commands()
+local config = redis.call("HMGET", KEYS[1], ARGV[1] .. ":limit", ARGV[1] .. ":interval")
+local limit, interval = tonumber(config[1]), tonumber(config[2])
+if not limit or not interval then
+	return -1
+end
+local time = redis.call("TIME")
+local n, now = tonumber(ARGV[2]), time[1] * 1000 + math.floor(time[2] / 1000)
+local bucket = redis.call("HMGET", KEYS[2], "tokens", "at")
+local tokens, at = tonumber(bucket[1]) or limit, tonumber(bucket[2]) or now
+if now > at then
+	tokens = math.min(limit, tokens + (now - at) * limit / interval)
+	at = now
+end
+if tokens < n then
+	return math.ceil((n - tokens) * interval / limit)
+end
+redis.call("HMSET", KEYS[2], "tokens", tostring(math.min(limit, tokens - n)), "at", at)
+redis.call("PEXPIRE", KEYS[2], interval)
+return 0
+`)
+
+// take takes n tokens from the rate limit of queue, or puts them back if n is
+// negative. It returns how long to wait before trying again if there are not
+// enough tokens, and 0 if queue has no rate limit. A queue found without rate
+// limit is not checked again for unlimitedInterval.
+func (q *qredis) take(queue string, n int64) (time.Duration, error) {
+	if at, ok := q.unlimited.Load(queue); ok && time.Since(at.(time.Time)) < unlimitedInterval {
+		return 0, nil
+	}
+	ms, err := takeScript.Run(q.redis, []string{qRateLimits, qRateLimit + ":" + queue}, queue, n).Int64()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	if ms < 0 {
+		q.unlimited.Store(queue, time.Now())
+		return 0, nil
+	}
+	q.unlimited.Delete(queue)
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// parseRateLimits parses the rate limits of the hash qRateLimits.
+func parseRateLimits(fields map[string]string) map[string]RateLimit {
+	limits := make(map[string]RateLimit)
+	for field, value := range fields {
+		i := strings.LastIndexByte(field, ':')
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			continue
+		}
+		queue := field[:i]
+		limit := limits[queue]
+		switch field[i+1:] {
+		case "limit":
+			limit.Limit = n
+		case "interval":
+			limit.Interval = time.Duration(n) * time.Millisecond
+		}
+		limits[queue] = limit
+	}
+	return limits
+}
@@ -0,0 +1,31 @@
+package q
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseRateLimits(t *testing.T) {
+	fields := map[string]string{
+		"a:limit":      "10",
+		"a:interval":   "1000",
+		"b:c:limit":    "5",
+		"b:c:interval": "60000",
+		"d:limit":      "not a number",
+		"d:interval":   "1000",
+		"no separator": "1",
+		"e:unknown":    "1",
+		"f:interval":   "500",
+	}
+	want := map[string]RateLimit{
+		"a":   {Limit: 10, Interval: time.Second},
+		"b:c": {Limit: 5, Interval: time.Minute},
+		"d":   {Interval: time.Second},
+		"e":   {},
+		"f":   {Interval: 500 * time.Millisecond},
+	}
+	if got := parseRateLimits(fields); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,130 @@
+package q
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+const (
+	qUnique  = "q:unique"
+	qUniques = "q:uniques"
+)
+
+// ErrDuplicate is returned by Send when a message with the same unique key is
+// pending or running.
+var ErrDuplicate = errors.New("duplicate message")
+
+// Unique drops the message if a message with the same key is pending or
+// running. The lock on key is released when the message is handled or
+// deleted, or after ttl if ttl > 0.
+func Unique(key string, ttl time.Duration) SendOption {
+	return func(options *sendOptions) {
+		options.uniqueKey = key
+		options.uniqueTTL = ttl
+	}
+}
+
+// lockScript sets the lock KEYS[1] on the unique key ARGV[2] to the message
+// ARGV[1] for ARGV[3] milliseconds, or without expiry if ARGV[3] is 0, unless
+// it is already set. The key is indexed in KEYS[2] by expiry time ARGV[4],
+// from which the keys expired before ARGV[5] are removed.
+var lockScript = redis.NewScript(`
+redis.call("ZREMRANGEBYSCORE", KEYS[2], "-inf", "(" .. ARGV[5])
+local ok
+if ARGV[3] == "0" then
+	ok = redis.call("SET", KEYS[1], ARGV[1], "NX")
+else
+	ok = redis.call("SET", KEYS[1], ARGV[1], "NX", "PX", ARGV[3])
+end
+if not ok then
+	return 0
+end
+redis.call("ZADD", KEYS[2], ARGV[4], ARGV[2])
+return 1
+`)
+
+// lock takes the unique lock of message, for ttl. It returns ErrDuplicate if
+// the lock is taken.
+func (q *qredis) lock(message Message, ttl time.Duration) error {
+	if ttl < 0 {
+		ttl = 0
+	}
+	now := time.Now()
+	expiry := "+inf"
+	if ttl > 0 {
+		expiry = strconv.FormatInt(now.Add(ttl).UnixNano()/int64(time.Millisecond), 10)
+	}
+	n, err := lockScript.Run(q.redis, []string{qUnique + ":" + message.UniqueKey, qUniques},
+		message.ID, message.UniqueKey, int64(ttl/time.Millisecond), expiry, now.UnixNano()/int64(time.Millisecond)).Int64()
+	if err != nil {
+		return errors.WithStack(err)
+	} else if n == 0 {
+		return ErrDuplicate
+	}
+	return nil
+}
+
+// unlockScript releases the lock KEYS[1] on the unique key ARGV[2] if it is
+// held by the message ARGV[1].
+var unlockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	redis.call("DEL", KEYS[1])
+	redis.call("ZREM", KEYS[2], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// unlock releases the unique lock of message, if it still holds it.
+func unlock(c redis.Cmdable, message Message) {
+	if message.UniqueKey == "" {
+		return
+	}
+	unlockScript.Eval(c, []string{qUnique + ":" + message.UniqueKey, qUniques}, message.ID, message.UniqueKey)
+}
+
+// Locks returns at most limit unique locks held by pending or running
+// messages, starting at cursor, from the first to expire to the last. limit is
+// at most maxLimit, which a limit <= 0 means too. The returned cursor is 0 when
+// there are no more locks. The expired locks are removed from the index by the
+// next lock, not by Locks.
+func (q *qredis) Locks(ctx context.Context, cursor, limit int64) ([]Lock, int64, error) {
+	limit = clampLimit(limit)
+	now := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	keys, err := q.redis.ZRangeByScoreWithScores(qUniques, redis.ZRangeBy{Min: now, Max: "+inf", Offset: cursor, Count: limit}).Result()
+	if err != nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	ids := make([]*redis.StringCmd, len(keys))
+	if _, err := q.redis.Pipelined(func(pipe redis.Pipeliner) error {
+		for i := range keys {
+			ids[i] = pipe.Get(qUnique + ":" + keys[i].Member.(string))
+		}
+		return nil
+	}); err != nil && err != redis.Nil {
+		return nil, 0, errors.WithStack(err)
+	}
+
+	var locks []Lock
+	for i := range keys {
+		id, err := ids[i].Result()
+		if err == redis.Nil {
+			continue
+		}
+		lock := Lock{Key: keys[i].Member.(string), MessageID: id}
+		if !math.IsInf(keys[i].Score, 1) {
+			lock.ExpiresAt = time.Unix(0, int64(keys[i].Score)*int64(time.Millisecond))
+		}
+		locks = append(locks, lock)
+	}
+	if int64(len(keys)) < limit {
+		return locks, 0, nil
+	}
+	return locks, cursor + limit, nil
+}
@@ -0,0 +1,169 @@
+package q
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/pkg/errors"
+)
+
+// heartbeatInterval is the interval between two heartbeats of a worker.
+const heartbeatInterval = 5 * time.Second
+
+// register stores the host, pid, queue and start time of the worker self.
+func (q *qredis) register(self, host string, pid int, queue string) error {
+	now := time.Now()
+	_, err := q.redis.Pipelined(func(pipe redis.Pipeliner) error {
+		pipe.HMSet(self, map[string]interface{}{
+			"host":       host,
+			"pid":        pid,
+			"queue":      queue,
+			"started_at": now.UnixNano(),
+			"heartbeat":  now.UnixNano(),
+		})
+		pipe.SAdd(qWorkers, self)
+		return nil
+	})
+	return errors.WithStack(err)
+}
+
+// heartbeat updates the heartbeat of the worker self, and renews its lease on
+// queue, every heartbeatInterval, until the returned function is called.
+func (q *qredis) heartbeat(self, queue string) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				var renewed func(redis.Cmdable) error
+				_, err := q.redis.Pipelined(func(pipe redis.Pipeliner) error {
+					pipe.HSet(self, "heartbeat", now.UnixNano())
+					renewed = renew(pipe, queue, self)
+					return nil
+				})
+				if noScript(err) {
+					err = renewed(q.redis)
+				}
+				if err != nil {
+					q.logger.Error("heartbeat failed", "worker", self, "error", err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// runningScript sets the field run_at of the worker KEYS[1] to the time of
+// Redis, in nanoseconds.
+var runningScript = redis.NewScript(`
+redis.replicate_commands()
+local now = redis.call("TIME")
+redis.call("HSET", KEYS[1], "run_at", now[1] .. string.format("%06d", now[2]) .. "000")
+return 1
+`)
+
+// pop moves a message from queue to the processing list of the worker
+// self, waiting up to pollInterval, and records when the worker started
+// handling it. It returns redis.Nil if no message came.
+//
+// BRPOPLPUSH is sent alone: go-redis only extends the read timeout by the
+// blocking time for commands sent outside of a pipeline.
+func (q *qredis) pop(queue, self, processing string) (Message, error) {
+	var message Message
+	if err := q.redis.BRPopLPush(queue, processing, pollInterval).Scan(&message); err != nil {
+		return message, err
+	}
+	if err := runningScript.Run(q.redis, []string{self}).Err(); err != nil {
+		return message, errors.WithStack(err)
+	}
+	return message, nil
+}
+
+// pipeWorkers queues in pipe the reads of the workers named names, with the
+// messages they are handling. The returned function returns the workers once
+// pipe is executed.
+func pipeWorkers(pipe redis.Pipeliner, names []string) func() (map[string]Worker, error) {
+	fields := make([]*redis.StringStringMapCmd, len(names))
+	current := make([]*redis.StringSliceCmd, len(names))
+	for i := range names {
+		fields[i] = pipe.HGetAll(names[i])
+		current[i] = pipe.LRange(qProcessing+strings.TrimPrefix(names[i], qWorker), 0, 0)
+	}
+
+	return func() (map[string]Worker, error) {
+		workers := make(map[string]Worker, len(names))
+		for i := range names {
+			worker, err := parseWorker(fields[i].Val(), current[i])
+			if err != nil {
+				return nil, err
+			}
+			workers[names[i]] = worker
+		}
+		return workers, nil
+	}
+}
+
+func parseWorker(fields map[string]string, current *redis.StringSliceCmd) (Worker, error) {
+	var worker Worker
+	worker.Host = fields["host"]
+	worker.PID, _ = strconv.Atoi(fields["pid"])
+	worker.Queue = fields["queue"]
+	worker.Processed, _ = strconv.ParseInt(fields["processed"], 10, 64)
+	worker.Failed, _ = strconv.ParseInt(fields["failed"], 10, 64)
+	if ns, err := strconv.ParseInt(fields["started_at"], 10, 64); err == nil {
+		worker.StartedAt = time.Unix(0, ns)
+	}
+	if ns, err := strconv.ParseInt(fields["heartbeat"], 10, 64); err == nil {
+		worker.Heartbeat = time.Unix(0, ns)
+	}
+
+	var messages []Message
+	if err := current.ScanSlice(&messages); err != nil {
+		return worker, errors.WithStack(err)
+	}
+	if len(messages) > 0 {
+		worker.Message = &messages[0]
+		if ns, err := strconv.ParseInt(fields["run_at"], 10, 64); err == nil {
+			runAt := time.Unix(0, ns)
+			worker.Message.RunAt = &runAt
+		}
+	}
+	return worker, nil
+}
+
+// Worker returns the worker name, as named in Stats. It returns ErrNotFound
+// when there is no such worker.
+func (q *qredis) Worker(ctx context.Context, name string) (Worker, error) {
+	// name comes from the user, only read the keys of known workers.
+	member, err := q.redis.SIsMember(qWorkers, name).Result()
+	if err != nil {
+		return Worker{}, errors.WithStack(err)
+	}
+	if !member {
+		return Worker{}, errors.WithStack(ErrNotFound)
+	}
+	var workers func() (map[string]Worker, error)
+	if _, err := q.redis.Pipelined(func(pipe redis.Pipeliner) error {
+		workers = pipeWorkers(pipe, []string{name})
+		return nil
+	}); err != nil {
+		return Worker{}, errors.WithStack(err)
+	}
+	found, err := workers()
+	if err != nil {
+		return Worker{}, err
+	}
+	return found[name], nil
+}